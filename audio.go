@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// -------------------------- AUDIO --------------------------
+
+// the realtime API default audio format: 16 bit little endian PCM, mono, 24kHz
+const (
+	audioSampleRate     = 24000
+	audioChannels       = 1
+	audioBitsPerSample  = 16
+	audioBytesPerSecond = audioSampleRate * audioChannels * audioBitsPerSample / 8
+	maxWAVFormatChunk   = 64 //a PCM format chunk is 16 bytes (18 or 40 with extensions), the size comes from the file
+)
+
+// openWAV checks that r is a WAV file in the realtime PCM16 format and returns a reader positioned at the start of the samples
+func openWAV(r io.Reader) (io.Reader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("reading wav header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	gotFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("reading wav chunk: %w", err)
+		}
+		id, size := string(chunk[0:4]), int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("wav format chunk too short")
+			}
+			if size > maxWAVFormatChunk {
+				return nil, fmt.Errorf("wav format chunk too large (%d bytes)", size)
+			}
+			fmtChunk := make([]byte, size+size%2) //with the padding byte of an odd size
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return nil, fmt.Errorf("reading wav format: %w", err)
+			}
+			format := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			channels := binary.LittleEndian.Uint16(fmtChunk[2:4])
+			rate := binary.LittleEndian.Uint32(fmtChunk[4:8])
+			bits := binary.LittleEndian.Uint16(fmtChunk[14:16])
+			if format != 1 || channels != audioChannels || rate != audioSampleRate || bits != audioBitsPerSample {
+				return nil, fmt.Errorf("unsupported wav format (need PCM %d bit mono %dHz, got format=%d channels=%d rate=%d bits=%d), convert it first, e.g. ffmpeg -i in.wav -ac 1 -ar 24000 -sample_fmt s16 out.wav",
+					audioBitsPerSample, audioSampleRate, format, channels, rate, bits)
+			}
+			gotFormat = true
+		case "data":
+			if !gotFormat {
+				return nil, errors.New("wav data chunk before format chunk")
+			}
+			return io.LimitReader(r, size), nil
+		default:
+			// chunks are word aligned, so odd sizes have a padding byte
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("skipping wav chunk %q: %w", id, err)
+			}
+		}
+	}
+}
+
+// wavHeader is the 44 byte header of a WAV file holding dataBytes of audio in the realtime PCM16 format
+func wavHeader(dataBytes uint32) []byte {
+	h := make([]byte, 0, 44)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, 36+dataBytes)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, 1) //PCM
+	h = binary.LittleEndian.AppendUint16(h, audioChannels)
+	h = binary.LittleEndian.AppendUint32(h, audioSampleRate)
+	h = binary.LittleEndian.AppendUint32(h, audioBytesPerSecond)
+	h = binary.LittleEndian.AppendUint16(h, audioChannels*audioBitsPerSample/8)
+	h = binary.LittleEndian.AppendUint16(h, audioBitsPerSample)
+	h = append(h, "data"...)
+	return binary.LittleEndian.AppendUint32(h, dataBytes)
+}
+
+// commandAvailable reports whether the program a shell command starts can be found, so a missing recorder/player
+// is reported up front with a hint instead of as a shell error in the middle of the session
+func commandAvailable(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	_, err := exec.LookPath(fields[0])
+	return err == nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// wavFile builds a RIFF file from the given chunks, each one an id and its body (a padding byte is added to odd sizes)
+func wavFile(chunks ...[2]string) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, c := range chunks {
+		body.WriteString(c[0])
+		binary.Write(&body, binary.LittleEndian, uint32(len(c[1])))
+		body.WriteString(c[1])
+		if len(c[1])%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	var f bytes.Buffer
+	f.WriteString("RIFF")
+	binary.Write(&f, binary.LittleEndian, uint32(body.Len()))
+	f.Write(body.Bytes())
+	return f.Bytes()
+}
+
+// pcmFormat is the fmt chunk of the realtime audio format, with extra bytes appended
+func pcmFormat(extra string) string {
+	return string(wavHeader(0)[20:36]) + extra
+}
+
+func TestOpenWAV(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    []byte
+		want    string
+		wantErr string
+	}{
+		{name: "plain", file: wavFile([2]string{"fmt ", pcmFormat("")}, [2]string{"data", "abcd"}), want: "abcd"},
+		{name: "odd chunk before the data", file: wavFile([2]string{"fmt ", pcmFormat("")}, [2]string{"LIST", "odd"}, [2]string{"data", "ab"}), want: "ab"},
+		{name: "odd format chunk", file: wavFile([2]string{"fmt ", pcmFormat("x")}, [2]string{"data", "ab"}), want: "ab"},
+		{name: "not riff", file: []byte("RIFX\x00\x00\x00\x00WAVE"), wantErr: "not a WAV file"},
+		{name: "short format", file: wavFile([2]string{"fmt ", "short"}), wantErr: "too short"},
+		{name: "huge format", file: wavFile([2]string{"fmt ", pcmFormat(strings.Repeat("x", 100))}), wantErr: "too large"},
+		{name: "data first", file: wavFile([2]string{"data", "ab"}), wantErr: "before format"},
+		{name: "wrong rate", file: wavFile([2]string{"fmt ", "\x01\x00\x01\x00\x44\xac\x00\x00\x88\x58\x01\x00\x02\x00\x10\x00"}), wantErr: "unsupported wav format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := openWAV(bytes.NewReader(tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(r)
+			if string(got) != tt.want {
+				t.Errorf("samples = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenWAVHugeFormatSize(t *testing.T) {
+	// the declared size is never allocated, a crafted header is refused before the chunk is read
+	file := []byte("RIFF\x00\x00\x00\x00WAVEfmt \xff\xff\xff\xff")
+	if _, err := openWAV(bytes.NewReader(file)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("err = %v, want a too large error", err)
+	}
+}
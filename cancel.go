@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// -------------------------- CANCEL (Ctrl+C while streaming) --------------------------
+
+// errResponseCancelled is returned by the stream when the user interrupted the response, the text streamed until then is returned with it
+var errResponseCancelled = errors.New("response cancelled")
+
+// every session has its own interrupts channel, a cancel meant for one conversation (a serve client that went away)
+// never reaches the response of another. it receives Ctrl+C only while a turn is running, the rest of the time
+// Ctrl+C keeps its default behavior (quit), except in kiosk mode where it is dropped
+func newInterrupts() chan os.Signal {
+	return make(chan os.Signal, 1)
+}
+
+func (s *realtimeSession) catchInterrupts() {
+	signal.Notify(s.interrupts, os.Interrupt)
+}
+
+func (s *realtimeSession) releaseInterrupts() {
+	signal.Stop(s.interrupts)
+	select {
+	case <-s.interrupts: //drop a Ctrl+C that came after the response was done
+	default:
+	}
+}
+
+// cancelCrossed is true when a response.done answered nothing we cancelled: the response was over before the
+// response.cancel arrived, and the server answers that cancel with a response_cancel_not_active error
+func cancelCrossed(done map[string]any) bool {
+	response, _ := done["response"].(map[string]any)
+	status, _ := response["status"].(string)
+	return status != "cancelled"
+}
+
+// dropCancelError waits briefly for the error of a crossed cancel so the next turn doesn't take it for its own.
+// the server sends it right after response.done, nothing else is expected in between
+func dropCancelError(ctx context.Context, eventsCh <-chan map[string]any) {
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case evt, ok := <-eventsCh:
+			if !ok {
+				return
+			}
+			errObj, _ := evt["error"].(map[string]any)
+			if code, _ := errObj["code"].(string); evt["type"] == "error" && code == "response_cancel_not_active" {
+				return
+			}
+			slog.Debug("dropped an event while waiting for the cancel error", "type", evt["type"])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// -------------------------- CAPABILITIES (from session.created) --------------------------
+
+// sessionCapabilities is what the server says the session can do. a field the server leaves out counts as supported,
+// so a gateway that skips session.created (or trims it) keeps every feature on, like before the detection existed
+type sessionCapabilities struct {
+	Model         string
+	Protocol      string
+	Modalities    []string //output modalities the session allows
+	Audio         bool     //spoken answers
+	Tools         bool     //function calling
+	Transcription bool     //transcripts of the user's audio
+	Voice         string
+}
+
+// detectCapabilities reads the session object of session.created, beta and GA shapes alike (nil means the event never came)
+func detectCapabilities(sessionCreated map[string]any, protocol string) sessionCapabilities {
+	caps := sessionCapabilities{Protocol: protocol, Audio: true, Tools: true, Transcription: true}
+	session, _ := sessionCreated["session"].(map[string]any)
+	if session == nil {
+		return caps
+	}
+	caps.Model, _ = session["model"].(string)
+
+	modalities, ok := session["output_modalities"].([]any) //GA
+	if !ok {
+		modalities, ok = session["modalities"].([]any)
+	}
+	if ok {
+		caps.Modalities = []string{}
+		for _, m := range modalities {
+			if s, ok := m.(string); ok {
+				caps.Modalities = append(caps.Modalities, s)
+			}
+		}
+		caps.Audio = slices.Contains(caps.Modalities, "audio")
+	}
+
+	if caps.Modalities != nil && !hasKey(session, "tools") {
+		caps.Tools = false //a fully described session without a tools list has no function calling
+	}
+
+	caps.Voice, _ = session["voice"].(string)
+	audio, _ := session["audio"].(map[string]any) //GA nests the voice and the transcription under audio
+	if output, _ := audio["output"].(map[string]any); caps.Voice == "" && output != nil {
+		caps.Voice, _ = output["voice"].(string)
+	}
+	if input, _ := audio["input"].(map[string]any); input != nil {
+		_, caps.Transcription = input["transcription"]
+	} else if hasKey(session, "input_audio_format") { //beta: a session that takes audio has the transcription setting
+		_, caps.Transcription = session["input_audio_transcription"]
+	}
+	return caps
+}
+
+func hasKey(m map[string]any, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func (c sessionCapabilities) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "protocol=%s", c.Protocol)
+	if c.Model != "" {
+		fmt.Fprintf(&b, " model=%s", c.Model)
+	}
+	if c.Modalities != nil {
+		fmt.Fprintf(&b, " modalities=%s", strings.Join(c.Modalities, ","))
+	}
+	fmt.Fprintf(&b, " audio=%t tools=%t transcription=%t", c.Audio, c.Tools, c.Transcription)
+	if c.Voice != "" {
+		fmt.Fprintf(&b, " voice=%s", c.Voice)
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+// -------------------------- CHAOS (fault injection) --------------------------
+
+// setting this env var to a probability between 0 and 1 turns on fault injection for every frame in both directions,
+// it is meant for exercising the error handling paths and should never be used for a real session
+const chaosEnvVar = "REALTIME_CLI_CHAOS"
+
+const chaosMaxDelay = 2 * time.Second
+
+type chaosInjector struct {
+	rate float64
+}
+
+// chaos is nil unless the env var is set, (*chaosInjector).frames is a no-op on nil
+var chaos *chaosInjector
+
+func loadChaos() *chaosInjector {
+	raw := os.Getenv(chaosEnvVar)
+	if raw == "" {
+		return nil
+	}
+	rate, err := strconv.ParseFloat(raw, 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		slog.Warn("chaos: ignoring invalid rate, expected a probability in (0,1]", "env", chaosEnvVar, "value", raw)
+		return nil
+	}
+	slog.Warn("chaos: fault injection enabled", "rate", rate)
+	return &chaosInjector{rate: rate}
+}
+
+// frames takes a single frame and returns what should actually go through the transport:
+// nothing (dropped), the frame twice (duplicated), a corrupted copy, or the frame itself (maybe after a delay)
+func (ci *chaosInjector) frames(direction string, data []byte) [][]byte {
+	if ci == nil || rand.Float64() >= ci.rate {
+		return [][]byte{data}
+	}
+
+	switch rand.IntN(4) {
+	case 0:
+		d := time.Duration(rand.Int64N(int64(chaosMaxDelay)))
+		slog.Info("chaos: delaying frame", "direction", direction, "delay", d)
+		time.Sleep(d)
+		return [][]byte{data}
+	case 1:
+		slog.Info("chaos: dropping frame", "direction", direction)
+		return nil
+	case 2:
+		slog.Info("chaos: duplicating frame", "direction", direction)
+		return [][]byte{data, data}
+	default:
+		slog.Info("chaos: corrupting frame", "direction", direction)
+		corrupted := append([]byte(nil), data...)
+		if len(corrupted) > 0 {
+			i := rand.IntN(len(corrupted))
+			corrupted[i] ^= 0xFF
+		}
+		return [][]byte{corrupted}
+	}
+}
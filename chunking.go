@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// -------------------------- OUTBOUND SIZE LIMITS --------------------------
+
+const (
+	// the server rejects client events bigger than this (it is also the documented max for one audio append)
+	maxOutboundMessageBytes = 15 << 20
+	// user text longer than this is split into several conversation items instead of one huge one
+	maxUserTextChunkBytes = 64 << 10
+)
+
+// checkOutboundSize fails early with a readable error instead of letting the server close the socket on an oversized frame
+func checkOutboundSize(payload []byte) error {
+	if len(payload) > maxOutboundMessageBytes {
+		return fmt.Errorf("outbound message is %d bytes, the limit is %d bytes", len(payload), maxOutboundMessageBytes)
+	}
+	return nil
+}
+
+// splitUserText cuts text into chunks of at most maxBytes, preferring to cut after a newline or a space
+// and never in the middle of a UTF-8 sequence
+func splitUserText(text string, maxBytes int) []string {
+	var chunks []string
+	for len(text) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if nl := strings.LastIndexByte(text[:cut], '\n'); nl > maxBytes/2 {
+			cut = nl + 1
+		} else if sp := strings.LastIndexByte(text[:cut], ' '); sp > maxBytes/2 {
+			cut = sp + 1
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	return append(chunks, text)
+}
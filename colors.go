@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// -------------------------- COLORS (-no-color, NO_COLOR) --------------------------
+
+// every role of the chat output has its own color: what the user types, the answers, tool notices and errors.
+// colors are off when NO_COLOR is set (https://no-color.org), with -no-color, in container mode and when stdout is not a terminal
+const (
+	colorUser      = "\033[94m" //bright blue
+	colorAssistant = "\033[32m"
+	colorTool      = "\033[33m"
+	colorError     = "\033[1;31m"
+)
+
+type palette struct {
+	enabled bool
+}
+
+var colors palette
+
+func loadColors() palette {
+	return palette{enabled: os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)}
+}
+
+// paint wraps s in the color. escape codes inside s (markdown, diffs) end with a reset, so the color is set again after each
+func (p palette) paint(color, s string) string {
+	if !p.enabled || s == "" {
+		return s
+	}
+	return color + strings.ReplaceAll(s, ansiReset, ansiReset+color) + ansiReset
+}
+
+func (p palette) user(s string) string      { return p.paint(colorUser, s) }
+func (p palette) assistant(s string) string { return p.paint(colorAssistant, s) }
+func (p palette) tool(s string) string      { return p.paint(colorTool, s) }
+func (p palette) errorText(s string) string { return p.paint(colorError, s) }
+
+// typing returns the codes that color what the user types next and that end it, the terminal echoes the input itself
+func (p palette) typing() (start, end string) {
+	if !p.enabled {
+		return "", ""
+	}
+	return colorUser, ansiReset
+}
+
+// writer paints everything written to out, the stream handler writes the answers through it
+func (p palette) writer(color string, out io.Writer) io.Writer {
+	if !p.enabled {
+		return out
+	}
+	return &paintWriter{palette: p, color: color, out: out}
+}
+
+type paintWriter struct {
+	palette
+	color string
+	out   io.Writer
+}
+
+func (w *paintWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(w.out, w.paint(w.color, string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
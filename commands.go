@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// -------------------------- SLASH COMMANDS --------------------------
+
+// a line starting with "/" is a command, "//" sends the rest of the line to the model with a single "/"
+const (
+	helpCommand         = "/help"
+	exitCommand         = "/exit"
+	modelCommand        = "/model"
+	instructionsCommand = "/instructions"
+	toolsCommand        = "/tools"
+	clearCommand        = "/clear"
+)
+
+// Command is a slash command of the chat. Run gets the text after the name; it handles the input itself and returns nil,
+// or returns the turn the model should answer instead (what /revise, /escalate and /form do).
+// an error from Run ends the chat, problems the user can fix are printed and Run returns nil
+type Command struct {
+	Name string //with the slash
+	Args string //how the arguments are written, for /help
+	Help string
+	Run  func(c *chatContext, args string) (*chatTurn, error)
+}
+
+// chatTurn is what the model is asked, typed is what goes into the transcript as the user's input
+type chatTurn struct {
+	input, typed string
+	out          OutputSink
+	escalate     bool //ask the strong model (-cheap-model)
+	revising     bool //show only what changed from the last answer
+}
+
+// chatContext is what the commands work on
+type chatContext struct {
+	sessions *SessionManager
+	lines    *promptReader
+	forms    map[string]formTemplate
+	commands *CommandRegistry
+	quit     bool //set by /exit, the chat ends after the command
+}
+
+// CommandRegistry keeps the commands in registration order, which is also the order /help lists them in
+type CommandRegistry struct {
+	order  []string
+	byName map[string]Command
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{byName: map[string]Command{}}
+}
+
+func (r *CommandRegistry) Register(cmd Command) error {
+	if !strings.HasPrefix(cmd.Name, "/") || len(cmd.Name) < 2 || strings.ContainsAny(cmd.Name, " \t") {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if cmd.Run == nil {
+		return fmt.Errorf("command %s has no Run", cmd.Name)
+	}
+	if _, ok := r.byName[cmd.Name]; ok {
+		return fmt.Errorf("command %s registered twice", cmd.Name)
+	}
+	r.order = append(r.order, cmd.Name)
+	r.byName[cmd.Name] = cmd
+	return nil
+}
+
+func (r *CommandRegistry) Lookup(name string) (Command, bool) {
+	cmd, ok := r.byName[name]
+	return cmd, ok
+}
+
+// dispatch runs the command of the input. handled is false for input that is not a command
+func (r *CommandRegistry) dispatch(c *chatContext, input string) (handled bool, turn *chatTurn, err error) {
+	if !strings.HasPrefix(input, "/") || strings.HasPrefix(input, "//") {
+		return false, nil, nil
+	}
+	name, args, _ := strings.Cut(input, " ")
+	cmd, ok := r.Lookup(name)
+	if !ok {
+		fmt.Print(colors.errorText(fmt.Sprintf("Unknown command %s, %s lists the commands (start with // to send a line that begins with /).", name, helpCommand)) + "\n\n")
+		return true, nil, nil
+	}
+	stats.recordFeature("command:" + name)
+	turn, err = cmd.Run(c, strings.TrimSpace(args))
+	return true, turn, err
+}
+
+func (r *CommandRegistry) help() string {
+	var b strings.Builder
+	b.WriteString("Commands:\n")
+	for _, name := range r.order {
+		cmd := r.byName[name]
+		usage := cmd.Name
+		if cmd.Args != "" {
+			usage += " " + cmd.Args
+		}
+		fmt.Fprintf(&b, "  %-38s %s\n", usage, cmd.Help)
+	}
+	return b.String()
+}
+
+// chatCommands returns the built-in commands, a new command is one more Register call
+func chatCommands() *CommandRegistry {
+	r := NewCommandRegistry()
+	for _, cmd := range []Command{
+		{Name: helpCommand, Help: "list the commands", Run: func(c *chatContext, _ string) (*chatTurn, error) {
+			fmt.Println(c.commands.help())
+			return nil, nil
+		}},
+		{Name: exitCommand, Help: "leave (typing exit works too)", Run: func(c *chatContext, _ string) (*chatTurn, error) {
+			c.quit = true
+			return nil, nil
+		}},
+		{Name: newSessionCommand, Help: "start another conversation", Run: runNewSession},
+		{Name: switchSessionCommand, Args: "<n>", Help: "switch to conversation n", Run: runSwitchSession},
+		{Name: listSessionsCommand, Help: "list the conversations", Run: func(c *chatContext, _ string) (*chatTurn, error) {
+			fmt.Println(c.sessions.list())
+			return nil, nil
+		}},
+		{Name: clearCommand, Help: "forget the current conversation and start it over", Run: runClear},
+		{Name: modelCommand, Args: "[name]", Help: "show the model, or start a conversation with another one", Run: runModel},
+		{Name: instructionsCommand, Args: "[text|default]", Help: "show or change the instructions of the next responses", Run: runInstructions},
+		{Name: toolsCommand, Help: "list the tools the model can call", Run: runTools},
+		{Name: setPrefix, Args: "[temperature|max_tokens <value>]", Help: "tune the next responses", Run: func(_ *chatContext, args string) (*chatTurn, error) {
+			sampling.set(args)
+			return nil, nil
+		}},
+		{Name: usageCommand, Help: "show the tokens used and the estimated cost", Run: func(_ *chatContext, _ string) (*chatTurn, error) {
+			fmt.Println(usage.summary())
+			return nil, nil
+		}},
+		{Name: savePrefix, Args: "<file.json|file.md>", Help: "export the conversation", Run: runSave},
+		{Name: loadPrefix, Args: "<file.json>", Help: "add the turns of a saved transcript to the conversation", Run: runLoad},
+		{Name: formPrefix, Args: "[name]", Help: "answer the questions of a form and send them as one prompt", Run: runForm},
+		{Name: escalateCommand, Help: "ask the last input again with the strong model (-cheap-model)", Run: runEscalate},
+		{Name: revisePrefix, Args: "<what to change>", Help: "revise the last answer and show only what changed", Run: runRevise},
+	} {
+		if err := r.Register(cmd); err != nil {
+			panic(err) //the built-in commands are fixed, a clash is a programming error
+		}
+	}
+	return r
+}
+
+func runNewSession(c *chatContext, _ string) (*chatTurn, error) {
+	cs, err := c.sessions.open()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Started session %d.\n\n", cs.id)
+	return nil, nil
+}
+
+func runSwitchSession(c *chatContext, args string) (*chatTurn, error) {
+	id, err := strconv.Atoi(args)
+	if err != nil {
+		fmt.Print("Usage: /switch <session number>\n\n")
+		return nil, nil
+	}
+	if err = c.sessions.switchTo(id); err != nil {
+		fmt.Printf("%v\n\n", err)
+		return nil, nil
+	}
+	fmt.Printf("Switched to session %d.\n\n", id)
+	return nil, nil
+}
+
+func runClear(c *chatContext, _ string) (*chatTurn, error) {
+	if err := c.sessions.reset(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Cleared, this is session %d now.\n\n", c.sessions.current.id)
+	return nil, nil
+}
+
+// runModel switches the model of new conversations and starts one, a realtime connection keeps the model it was opened with
+func runModel(c *chatContext, args string) (*chatTurn, error) {
+	if args == "" {
+		fmt.Printf("Model: %s\n\n", c.sessions.current.sess.model)
+		return nil, nil
+	}
+	if config.cheapModel != "" {
+		fmt.Print("The model can't be changed while routing with -cheap-model.\n\n")
+		return nil, nil
+	}
+	previous := c.sessions.model
+	c.sessions.model = args
+	cs, err := c.sessions.open()
+	if err != nil { //most likely a model name the server doesn't know, the current session is still there
+		c.sessions.model = previous
+		fmt.Print(colors.errorText(fmt.Sprintf("Could not start a session with %s: %v", args, err)) + "\n\n")
+		return nil, nil
+	}
+	fmt.Printf("Started session %d with %s, the other sessions keep their model.\n\n", cs.id, args)
+	return nil, nil
+}
+
+func runInstructions(_ *chatContext, args string) (*chatTurn, error) {
+	switch args {
+	case "":
+	case "default":
+		config.instructions = defaultInstructions
+	default:
+		config.instructions = args
+	}
+	fmt.Printf("Instructions: %s\n\n", config.instructions)
+	return nil, nil
+}
+
+func runTools(c *chatContext, _ string) (*chatTurn, error) {
+	sess := c.sessions.current.sess
+	if !sess.Capabilities().Tools {
+		fmt.Print("This model can't call tools.\n\n")
+		return nil, nil
+	}
+	fmt.Println("Tools:")
+	for _, name := range sess.tools.order {
+		fmt.Printf("  %-12s %s\n", name, sess.tools.byName[name].Description)
+	}
+	fmt.Println()
+	return nil, nil
+}
+
+func runSave(c *chatContext, path string) (*chatTurn, error) {
+	if path == "" {
+		fmt.Print("Usage: /save <file.json|file.md>\n\n")
+	} else if err := c.sessions.current.transcript.save(path); err != nil {
+		fmt.Print(colors.errorText(fmt.Sprintf("Could not save the transcript: %v", err)) + "\n\n")
+	} else {
+		fmt.Printf("Transcript saved to %s.\n\n", path)
+	}
+	return nil, nil
+}
+
+func runLoad(c *chatContext, path string) (*chatTurn, error) {
+	cur := c.sessions.current
+	if path == "" {
+		fmt.Print("Usage: /load <file.json>\n\n")
+		return nil, nil
+	}
+	loaded, err := loadConversationLog(path)
+	if err != nil {
+		fmt.Print(colors.errorText(fmt.Sprintf("Could not load the transcript: %v", err)) + "\n\n")
+		return nil, nil
+	}
+	if err = cur.sess.importHistory(loaded.items()); err != nil {
+		fmt.Print(colors.errorText(fmt.Sprintf("Could not load the transcript: %v", err)) + "\n\n")
+		return nil, cur.sess.checkReader() //a dropped connection is reconnected, without the transcript
+	}
+	cur.transcript.Entries = append(cur.transcript.Entries, loaded.Entries...)
+	fmt.Printf("Loaded %d entries from %s.\n\n", len(loaded.Entries), path)
+	return nil, nil
+}
+
+func runForm(c *chatContext, name string) (*chatTurn, error) {
+	form, ok := c.forms[name]
+	if !ok {
+		if name != "" {
+			fmt.Printf("Unknown form %q.\n", name)
+		}
+		listForms(c.forms)
+		return nil, nil
+	}
+	filled, err := form.fill(c.lines)
+	if errors.Is(err, errFormCancelled) {
+		fmt.Print("Form cancelled.\n\n")
+		return nil, nil
+	}
+	if err != nil { //end of input or the session time is up, the next read ends the chat
+		fmt.Println()
+		return nil, nil
+	}
+	return &chatTurn{input: filled, typed: filled, out: newTerminalSink(os.Stdout)}, nil
+}
+
+func runEscalate(c *chatContext, _ string) (*chatTurn, error) {
+	cur := c.sessions.current
+	if cur.router == nil {
+		fmt.Print("Routing is off, start with -cheap-model to answer with a cheaper model first.\n\n")
+		return nil, nil
+	}
+	if !cur.router.escalatable {
+		fmt.Print("Nothing to escalate, the last answer did not come from the cheap model.\n\n")
+		return nil, nil
+	}
+	return &chatTurn{input: cur.lastInput, typed: cur.lastInput, out: newTerminalSink(os.Stdout), escalate: true}, nil
+}
+
+func runRevise(c *chatContext, change string) (*chatTurn, error) {
+	cur := c.sessions.current
+	if change == "" {
+		fmt.Print("Usage: /revise <what to change>\n\n")
+		return nil, nil
+	}
+	if cur.lastAnswer == "" {
+		fmt.Print("Nothing to revise yet.\n\n")
+		return nil, nil
+	}
+	return &chatTurn{input: revisePrompt + change, typed: revisePrefix + " " + change, out: discardSink{}, revising: true}, nil
+}
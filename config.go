@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -------------------------- CONFIG (file + flags) --------------------------
+
+// the config file is optional, its path can be changed with this env var
+const (
+	configEnvVar      = "REALTIME_CLI_CONFIG"
+	defaultConfigFile = ".realtime-cli.yaml" //in the home directory
+)
+
+// cliConfig holds the settings that used to be hardcoded, the precedence is flags > env vars > config file > defaults
+type cliConfig struct {
+	model            string
+	instructions     string
+	url              string        //realtime endpoint, without the query string
+	region           string        //a region name or "auto", replaces url when set
+	timeout          time.Duration //how long a single response may take to stream
+	log              logOptions
+	csvTool          bool          //offer the query_csv tool, it reads the .csv files of the sandbox or the working directory
+	shellTool        bool          //offer the run_command tool to the model
+	shellAllowlist   []string      //the programs run_command may run
+	sandbox          string        //directory the read_file and write_file tools work in, empty leaves them out
+	cheapModel       string        //answers every turn first when set, model is only asked when the answer looks unsure
+	userAgent        string        //User-Agent of the websocket handshake, empty keeps Go's default
+	headers          http.Header   //extra handshake headers, for attribution by egress proxies and support requests
+	maxSession       time.Duration //the chat ends with a wrap-up summary after this long, 0 is no limit
+	sessionWarn      time.Duration //how long before the end the user gets a note
+	wrapUpFile       string        //where the wrap-up summary goes, empty is a timestamped file in the working directory
+	kiosk            bool          //locked down mode for public terminals
+	kioskIdle        time.Duration //the kiosk conversation is cleared after this long without input
+	record           string        //NDJSON file every websocket frame is written to
+	replay           string        //NDJSON recording to render instead of connecting
+	stops            []string      //the streamed answer is cut at the first of these and the response cancelled
+	extractors       []extractor   //regexes run over the streamed answer, every match is reported right away
+	extractOut       string        //JSON lines file the matches are appended to
+	overlay          string        //address of the captions page and websocket for OBS, empty is off
+	podcast          string        //WAV file a chat with spoken answers is recorded to, with .vtt and .srt captions next to it
+	noColor          bool          //-no-color, NO_COLOR works too
+	plain            bool          //print the answers as they stream, without rendering markdown
+	validate         string        //checks every answer, a failed one is asked again
+	validateAttempts int           //answers per turn with -validate, the first one included
+	toolFooter       bool          //every answer that used tools is followed by a compact footer of the calls
+	previewTools     bool          //every tool call is shown before it runs, to run, edit or reject it
+	toolConcurrency  int           //workers the function calls of one response run on
+	toolTimeouts     toolTimeouts  //how long a tool call may run
+	writeRetries     int           //how many times a write that timed out is retried, 0 disables the retries
+
+	maxToolCallsPerResponse int   //0 is unlimited
+	maxToolCallsPerSession  int   //0 is unlimited
+	maxFetchBytes           int64 //what the tools that download may read in a session, 0 is unlimited
+}
+
+var config = cliConfig{
+	model:            modelName,
+	instructions:     defaultInstructions,
+	url:              realtimeURL,
+	timeout:          30 * time.Second,
+	sessionWarn:      5 * time.Minute,
+	kioskIdle:        2 * time.Minute,
+	validateAttempts: 3,
+	shellAllowlist:   defaultShellAllowlist,
+	toolConcurrency:  defaultToolConcurrency,
+	writeRetries:     defaultWriteRetries,
+
+	maxToolCallsPerResponse: defaultMaxCallsPerResponse,
+	maxToolCallsPerSession:  defaultMaxCallsPerSession,
+	maxFetchBytes:           defaultMaxFetchBytes,
+}
+
+func configPath() string {
+	if p := os.Getenv(configEnvVar); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, defaultConfigFile)
+}
+
+// loadConfigFile applies the config file over the defaults, a missing file is not an error.
+// only flat "key: value" lines are supported (with # comments and optional quotes), which is all this file needs
+func loadConfigFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected \"key: value\"", path, lineNo)
+		}
+		key, value = strings.TrimSpace(key), unquoteConfigValue(strings.TrimSpace(value))
+
+		switch key {
+		case "model":
+			config.model = value
+		case "instructions":
+			config.instructions = value
+		case "url":
+			config.url = value
+		case "region":
+			config.region = value
+		case "user_agent":
+			config.userAgent = value
+		case "header": //repeatable, "header: X-Team: search"
+			name, headerValue, _ := strings.Cut(value, ":")
+			if err := addDialHeader(name, headerValue); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "stop": //repeatable, one stop string per line
+			if value == "" {
+				return fmt.Errorf("%s:%d: stop can't be empty", path, lineNo)
+			}
+			config.stops = append(config.stops, value)
+		case "timeout":
+			if config.timeout, err = time.ParseDuration(value); err != nil || config.timeout <= 0 {
+				return fmt.Errorf("%s:%d: timeout must be a positive duration like 45s, got %q", path, lineNo, value)
+			}
+		case "tool_footer":
+			if config.toolFooter, err = parseSwitch(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "preview_tools":
+			if config.previewTools, err = parseSwitch(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "max_tool_calls_per_response", "max_tool_calls_per_session", "max_fetch_bytes":
+			if err := setLimit(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "tool_concurrency":
+			if config.toolConcurrency, err = parseToolConcurrency(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "tool_timeout":
+			if config.toolTimeouts.all, err = parseToolTimeout(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "tool_timeouts":
+			if config.toolTimeouts.byTool, err = parseToolTimeouts(value); err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", path, lineNo, key, err)
+			}
+		case "csv_tool":
+			if config.csvTool, err = parseSwitch(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "shell_allowlist":
+			if config.shellAllowlist, err = parseShellAllowlist(value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		case "write_retries":
+			if config.writeRetries, err = parseWriteRetries(key, value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		default:
+			return fmt.Errorf("%s:%d: unknown key %q (known keys: model, instructions, url, region, timeout, user_agent, header, stop, tool_footer, preview_tools, max_tool_calls_per_response, max_tool_calls_per_session, max_fetch_bytes, tool_concurrency, tool_timeout, tool_timeouts, csv_tool, shell_allowlist, write_retries)", path, lineNo, key)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadConfigEnv applies REALTIME_CLI_MODEL, _INSTRUCTIONS, _URL, _REGION, _TIMEOUT, _USER_AGENT, _HEADERS and the tool
+// settings over the config file, so containers can be configured without files or flags
+func loadConfigEnv() error {
+	if v := os.Getenv("REALTIME_CLI_MODEL"); v != "" {
+		config.model = v
+	}
+	if v := os.Getenv("REALTIME_CLI_INSTRUCTIONS"); v != "" {
+		config.instructions = v
+	}
+	if v := os.Getenv("REALTIME_CLI_URL"); v != "" {
+		config.url = v
+	}
+	if v := os.Getenv("REALTIME_CLI_REGION"); v != "" {
+		config.region = v
+	}
+	if v := os.Getenv("REALTIME_CLI_USER_AGENT"); v != "" {
+		config.userAgent = v
+	}
+	if v := os.Getenv("REALTIME_CLI_HEADERS"); v != "" { //Name=value pairs separated by commas, added to the config file ones
+		for _, pair := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("REALTIME_CLI_HEADERS: expected Name=value, got %q", pair)
+			}
+			if err := addDialHeader(name, value); err != nil {
+				return fmt.Errorf("REALTIME_CLI_HEADERS: %w", err)
+			}
+		}
+	}
+	if v := os.Getenv("REALTIME_CLI_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("REALTIME_CLI_TIMEOUT must be a positive duration like 45s, got %q", v)
+		}
+		config.timeout = timeout
+	}
+	if v := os.Getenv(toolFooterEnvVar); v != "" {
+		on, err := parseSwitch(toolFooterEnvVar, v)
+		if err != nil {
+			return err
+		}
+		config.toolFooter = on
+	}
+	if v := os.Getenv(toolPreviewEnvVar); v != "" {
+		on, err := parseSwitch(toolPreviewEnvVar, v)
+		if err != nil {
+			return err
+		}
+		config.previewTools = on
+	}
+	if v := os.Getenv(csvToolEnvVar); v != "" {
+		on, err := parseSwitch(csvToolEnvVar, v)
+		if err != nil {
+			return err
+		}
+		config.csvTool = on
+	}
+	if v := os.Getenv(toolConcurrencyEnvVar); v != "" {
+		n, err := parseToolConcurrency(toolConcurrencyEnvVar, v)
+		if err != nil {
+			return err
+		}
+		config.toolConcurrency = n
+	}
+	if v := os.Getenv(writeRetriesEnvVar); v != "" {
+		n, err := parseWriteRetries(writeRetriesEnvVar, v)
+		if err != nil {
+			return err
+		}
+		config.writeRetries = n
+	}
+	if v := os.Getenv(toolTimeoutEnvVar); v != "" {
+		d, err := parseToolTimeout(toolTimeoutEnvVar, v)
+		if err != nil {
+			return err
+		}
+		config.toolTimeouts.all = d
+	}
+	if v := os.Getenv(toolTimeoutsEnvVar); v != "" {
+		byTool, err := parseToolTimeouts(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", toolTimeoutsEnvVar, err)
+		}
+		config.toolTimeouts.byTool = byTool
+	}
+	if v := os.Getenv(shellAllowlistEnvVar); v != "" {
+		allow, err := parseShellAllowlist(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", shellAllowlistEnvVar, err)
+		}
+		config.shellAllowlist = allow
+	}
+	for key, envVar := range map[string]string{
+		"max_tool_calls_per_response": maxCallsPerResponseEnvVar,
+		"max_tool_calls_per_session":  maxCallsPerSessionEnvVar,
+		"max_fetch_bytes":             maxFetchBytesEnvVar,
+	} {
+		if v := os.Getenv(envVar); v != "" {
+			if err := setLimit(key, v); err != nil {
+				return fmt.Errorf("%s: %w", envVar, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setLimit sets one of the tool limits by its config key
+func setLimit(key, value string) error {
+	n, err := parseLimit(key, value)
+	if err != nil {
+		return err
+	}
+	switch key {
+	case "max_tool_calls_per_response":
+		config.maxToolCallsPerResponse = int(n)
+	case "max_tool_calls_per_session":
+		config.maxToolCallsPerSession = int(n)
+	case "max_fetch_bytes":
+		config.maxFetchBytes = n
+	}
+	return nil
+}
+
+// parseSwitch reads an on/off setting of the config file or the environment: 1, true, 0 or false
+func parseSwitch(name, value string) (bool, error) {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be 1 or 0 (true or false), got %q", name, value)
+	}
+	return on, nil
+}
+
+// the handshake sets these itself, an extra header must not replace them (the auth header is set after the extra ones)
+var reservedDialHeaders = []string{"Host", "Connection", "Upgrade", "Authorization", "Openai-Beta"}
+
+func addDialHeader(name, value string) error {
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if name == "" || strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) }) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("header %s: the value can't span lines", name)
+	}
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	if name == "User-Agent" {
+		return errors.New("the User-Agent is set with user_agent (or REALTIME_CLI_USER_AGENT), not as a header")
+	}
+	if slices.Contains(reservedDialHeaders, name) || strings.HasPrefix(name, "Sec-Websocket-") {
+		return fmt.Errorf("header %s is set by the client itself", name)
+	}
+	if config.headers == nil {
+		config.headers = http.Header{}
+	}
+	config.headers.Add(name, value)
+	return nil
+}
+
+func unquoteConfigValue(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+	}
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		return strings.ReplaceAll(v[1:len(v)-1], "''", "'")
+	}
+	// an unquoted value ends at a " #" comment
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v
+}
+
+// parseChatFlags lets the flags of the chat mode override the config file
+func parseChatFlags(args []string) error {
+	flags := flag.NewFlagSet("realtime-cli", flag.ContinueOnError)
+	flags.StringVar(&config.model, "model", config.model, "realtime model")
+	flags.StringVar(&config.instructions, "instructions", config.instructions, "instructions the model gets with every response")
+	flags.StringVar(&config.url, "url", config.url, "realtime WebSocket endpoint")
+	flags.StringVar(&config.cheapModel, "cheap-model", config.cheapModel, "answer with this cheaper model first and re-ask -model only when the answer looks unsure (or on /escalate)")
+	flags.StringVar(&config.region, "region", config.region, "endpoint region (us, eu or one from "+regionsEnvVar+"), or auto to pick the fastest handshake; overrides -url")
+	flags.DurationVar(&config.timeout, "timeout", config.timeout, "how long a single response may take to stream")
+	flags.StringVar(&config.log.level, "log-level", config.log.level, "log level: debug, info, warn or error (info logs the tool calls and reconnects, debug every event and the connection)")
+	flags.BoolVar(&config.log.json, "log-json", config.log.json, "write the logs as JSON")
+	flags.StringVar(&config.log.file, "log-file", config.log.file, "append the logs to this file instead of stderr")
+	flags.BoolVar(&config.csvTool, "enable-csv-tool", config.csvTool, "let the model query the .csv files of -sandbox, or of the working directory without it (query_csv tool; csv_tool, "+csvToolEnvVar+")")
+	flags.BoolVar(&config.shellTool, "enable-shell-tool", config.shellTool, "let the model run the programs of -shell-allowlist (run_command tool)")
+	flags.Func("shell-allowlist", "comma separated programs -enable-shell-tool may run (shell_allowlist, "+shellAllowlistEnvVar+"; default "+strings.Join(defaultShellAllowlist, ",")+")", func(v string) error {
+		allow, err := parseShellAllowlist(v)
+		if err != nil {
+			return err
+		}
+		config.shellAllowlist = allow
+		return nil
+	})
+	flags.StringVar(&config.sandbox, "sandbox", config.sandbox, "let the model read and write files in this directory (read_file and write_file tools)")
+	flags.DurationVar(&config.maxSession, "max-session", config.maxSession, "end the chat after this long (e.g. 30m) with a wrap-up summary, for kiosks and demos")
+	flags.DurationVar(&config.sessionWarn, "max-session-warn", config.sessionWarn, "how long before the end of -max-session to warn")
+	flags.StringVar(&config.wrapUpFile, "wrap-up-file", config.wrapUpFile, "file the -max-session wrap-up summary is written to (default wrap-up-<time>.md)")
+	flags.BoolVar(&config.kiosk, "kiosk", config.kiosk, "locked down mode for public terminals: no commands, only the tools in "+kioskToolsEnvVar+", cleared when idle")
+	flags.DurationVar(&config.kioskIdle, "kiosk-idle", config.kioskIdle, "how long without input before the kiosk clears the conversation")
+	flags.StringVar(&config.record, "record", config.record, "write every websocket frame with a timestamp to this NDJSON file")
+	flags.StringVar(&config.replay, "replay", config.replay, "render a recording made with -record offline instead of connecting")
+	flags.Func("stop", "cut the answer at this string and cancel the rest of the response (repeatable)", func(v string) error {
+		if v == "" {
+			return errors.New("a stop string can't be empty")
+		}
+		config.stops = append(config.stops, v)
+		return nil
+	})
+	flags.Func("extract", "report every match of this name=regex in the streamed answer right away (repeatable)", func(v string) error {
+		ex, err := parseExtractor(v)
+		if err != nil {
+			return err
+		}
+		config.extractors = append(config.extractors, ex)
+		return nil
+	})
+	flags.StringVar(&config.extractOut, "extract-out", config.extractOut, "append the -extract matches to this file as JSON lines")
+	flags.StringVar(&config.overlay, "overlay", config.overlay, "serve live captions of the chat for OBS on this address, e.g. 127.0.0.1:8092 (page at /, websocket at /ws)")
+	flags.StringVar(&config.podcast, "podcast", config.podcast, "record a chat with spoken answers to this WAV file, with WebVTT and SRT captions of both sides next to it")
+	flags.BoolVar(&config.noColor, "no-color", config.noColor, "print without colors (setting NO_COLOR does the same)")
+	flags.BoolVar(&config.plain, "plain", config.plain, "print the answers as they stream instead of rendering their markdown (it is never rendered when the output is not a terminal)")
+	flags.StringVar(&config.validate, "validate", config.validate, "check every answer and ask again on failure: json, json:key1,key2 or cmd:<program args> (gets the answer on stdin)")
+	flags.IntVar(&config.validateAttempts, "validate-attempts", config.validateAttempts, "answers per turn with -validate before the best one is kept")
+	flags.BoolVar(&config.toolFooter, "tool-footer", config.toolFooter, "follow every answer that used tools with a footer like [tools: multiply(3,4)→12] (tool_footer, "+toolFooterEnvVar+")")
+	flags.BoolVar(&config.previewTools, "preview-tools", config.previewTools, "show every tool call before it runs, to run it, edit its arguments or reject it (preview_tools, "+toolPreviewEnvVar+")")
+	flags.IntVar(&config.maxToolCallsPerResponse, "max-tool-calls-per-response", config.maxToolCallsPerResponse, "tool calls the model may make in one response, 0 is unlimited")
+	flags.IntVar(&config.maxToolCallsPerSession, "max-tool-calls-per-session", config.maxToolCallsPerSession, "tool calls the model may make in the whole chat, 0 is unlimited")
+	flags.Int64Var(&config.maxFetchBytes, "max-fetch-bytes", config.maxFetchBytes, "bytes the tools that download may read in the whole chat, 0 is unlimited")
+	flags.DurationVar(&config.toolTimeouts.all, "tool-timeout", config.toolTimeouts.all, "how long every tool call may run, unset is 30s or the tool's own (tool_timeout, "+toolTimeoutEnvVar+")")
+	flags.Func("tool-timeouts", "per tool timeouts like fetch_url=45s,run_command=5s, over -tool-timeout (tool_timeouts, "+toolTimeoutsEnvVar+")", func(v string) error {
+		byTool, err := parseToolTimeouts(v)
+		if err != nil {
+			return err
+		}
+		config.toolTimeouts.byTool = byTool
+		return nil
+	})
+	flags.IntVar(&config.toolConcurrency, "tool-concurrency", config.toolConcurrency, "tool calls of one response that run at the same time, 1 runs them one by one (tool_concurrency, "+toolConcurrencyEnvVar+")")
+	flags.IntVar(&config.writeRetries, "write-retries", config.writeRetries, "times a write that timed out is retried with jittered backoff, 0 disables the retries (write_retries, "+writeRetriesEnvVar+")")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: realtime-cli [flags]\n       realtime-cli transcribe|notes|dictate|merge|diff|serve|mock-server|local-server [flags]\n\nflags (defaults come from %s when it exists):\n", configPath())
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	if config.timeout <= 0 {
+		return errors.New("-timeout must be positive")
+	}
+	if config.maxToolCallsPerResponse < 0 || config.maxToolCallsPerSession < 0 || config.maxFetchBytes < 0 {
+		return errors.New("-max-tool-calls-per-response, -max-tool-calls-per-session and -max-fetch-bytes can't be negative")
+	}
+	if config.toolTimeouts.all < 0 {
+		return errors.New("-tool-timeout can't be negative")
+	}
+	if config.toolConcurrency < 1 {
+		return errors.New("-tool-concurrency must be at least 1")
+	}
+	if config.writeRetries < 0 {
+		return errors.New("-write-retries can't be negative")
+	}
+	if config.sandbox != "" {
+		abs, err := filepath.Abs(config.sandbox)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			return fmt.Errorf("-sandbox %s is not a directory", config.sandbox)
+		}
+		config.sandbox = abs //the tools still work after a change of the working directory
+	}
+	if config.kiosk && config.kioskIdle <= 0 {
+		return errors.New("-kiosk-idle must be positive")
+	}
+	if config.maxSession < 0 || config.sessionWarn < 0 {
+		return errors.New("-max-session and -max-session-warn can't be negative")
+	}
+	if config.cheapModel == config.model {
+		config.cheapModel = "" //nothing to route
+	}
+	if config.validate != "" {
+		if config.validateAttempts < 1 {
+			return errors.New("-validate-attempts must be at least 1")
+		}
+		var err error
+		if validator, err = parseValidator(config.validate); err != nil {
+			return fmt.Errorf("-validate: %w", err)
+		}
+	}
+	if config.record != "" && config.replay != "" {
+		return errors.New("-record and -replay can't be used together")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// -------------------------- CONTAINER MODE --------------------------
+
+// in container mode nothing assumes a terminal: prompts are read line by line from stdin until EOF, every finished turn is
+// written to stdout as JSON lines, the human oriented output goes to stderr and a health server is started
+const (
+	containerEnvVar   = "REALTIME_CLI_CONTAINER"
+	healthAddrEnvVar  = "REALTIME_CLI_HEALTH_ADDR"
+	defaultHealthAddr = ":8080"
+)
+
+func loadContainerMode() bool {
+	return os.Getenv(containerEnvVar) == "1"
+}
+
+// sessionReady backs /readyz, it is set once the realtime session is open
+var sessionReady atomic.Bool
+
+// startHealthServer serves /healthz (the process is up) and /readyz (the session is open), an empty address disables it
+func startHealthServer() {
+	addr, ok := os.LookupEnv(healthAddrEnvVar)
+	if !ok {
+		addr = defaultHealthAddr
+	}
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !sessionReady.Load() {
+			http.Error(w, "session not open", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ready\n")
+	})
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			slog.Error("health server stopped", "addr", addr, "err", err)
+		}
+	}()
+}
+
+// jsonLines writes the entries of every finished turn as one JSON object per line
+type jsonLines struct {
+	enc *json.Encoder
+}
+
+// redirectForContainer moves the human oriented output to stderr and returns the writer for the JSON lines (the real stdout)
+func redirectForContainer() *jsonLines {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return &jsonLines{enc: json.NewEncoder(stdout)}
+}
+
+func (j *jsonLines) write(entries ...transcriptEntry) {
+	for _, e := range entries {
+		if err := j.enc.Encode(e); err != nil {
+			slog.Error("container: writing the transcript", "err", err)
+		}
+	}
+}
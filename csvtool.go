@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -------------------------- query_csv TOOL --------------------------
+
+const (
+	csvToolEnvVar   = "REALTIME_CLI_CSV_TOOL"
+	csvInstructions = " When the user asks about data in a CSV file, use the query_csv tool instead of guessing numbers."
+	// rows sent back to the model when no aggregate was asked for
+	csvDefaultRowLimit = 20
+	csvMaxRowLimit     = 200
+	csvMaxBytes        = 16 << 20 //a bigger file is refused instead of being read into memory
+)
+
+var csvOps = []string{"=", "!=", ">", ">=", "<", "<=", "contains"}
+
+var queryCSVTool = Tool{
+	Name:        "query_csv",
+	Description: "Query a local CSV file (first row is the header). Filter rows, optionally group them, and either aggregate one column or return the matching rows.",
+	JSONSchema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{"type": "string", "description": "path of the .csv file, relative to the user's data directory"},
+			"where": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"column": map[string]any{"type": "string"},
+						"op":     map[string]any{"type": "string", "enum": csvOps},
+						"value":  map[string]any{"type": "string"},
+					},
+					"required": []string{"column", "op", "value"},
+				},
+			},
+			"group_by":  map[string]any{"type": "string", "description": "column to group by before aggregating"},
+			"aggregate": map[string]any{"type": "string", "enum": []string{"count", "sum", "avg", "min", "max"}},
+			"column":    map[string]any{"type": "string", "description": "column to aggregate (not needed for count)"},
+			"limit":     map[string]any{"type": "integer", "description": "max rows to return when not aggregating"},
+		},
+		"required": []string{"path"},
+	},
+	Handler: func(_ context.Context, argsJSON string) (string, error) { return queryCSV(argsJSON) },
+}
+
+type csvCondition struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  string `json:"value"`
+}
+
+type csvQuery struct {
+	Path      string         `json:"path"`
+	Where     []csvCondition `json:"where"`
+	GroupBy   string         `json:"group_by"`
+	Aggregate string         `json:"aggregate"`
+	Column    string         `json:"column"`
+	Limit     int            `json:"limit"`
+}
+
+// queryCSV runs the query and returns the JSON output for the model, problems with the query itself
+// (bad path, unknown column, ...) are returned as {"error": ...} so the model can correct itself
+func queryCSV(argsJSON string) (string, error) {
+	var q csvQuery
+	if err := json.Unmarshal([]byte(argsJSON), &q); err != nil {
+		return "", fmt.Errorf("bad query_csv args: %w", err)
+	}
+	result, err := q.run()
+	if err != nil {
+		result = map[string]any{"error": err.Error()}
+	}
+	out, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (q csvQuery) run() (any, error) {
+	f, err := openCSV(q.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	limited := &io.LimitedReader{R: f, N: csvMaxBytes + 1}
+	records, err := csv.NewReader(limited).ReadAll()
+	if limited.N == 0 { //before the parse error a cut last line would give
+		return nil, fmt.Errorf("%s is larger than %d MiB", q.Path, csvMaxBytes>>20)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", q.Path, err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	header, rows := records[0], records[1:]
+
+	colIndex := func(name string) (int, error) {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown column %q, the columns are: %s", name, strings.Join(header, ", "))
+	}
+
+	// filter
+	for _, cond := range q.Where {
+		idx, err := colIndex(cond.Column)
+		if err != nil {
+			return nil, err
+		}
+		var kept [][]string
+		for _, row := range rows {
+			ok, err := matchCSVCondition(row[idx], cond.Op, cond.Value)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	if q.Aggregate == "" {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = csvDefaultRowLimit
+		}
+		limit = min(limit, csvMaxRowLimit)
+		return map[string]any{
+			"columns":       header,
+			"rows":          rows[:min(limit, len(rows))],
+			"matching_rows": len(rows),
+			"truncated":     len(rows) > limit,
+		}, nil
+	}
+
+	valueIdx := -1
+	if q.Aggregate != "count" {
+		if valueIdx, err = colIndex(q.Column); err != nil {
+			return nil, err
+		}
+	}
+	groupIdx := -1
+	if q.GroupBy != "" {
+		if groupIdx, err = colIndex(q.GroupBy); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := map[string][][]string{}
+	for _, row := range rows {
+		key := ""
+		if groupIdx >= 0 {
+			key = row[groupIdx]
+		}
+		groups[key] = append(groups[key], row)
+	}
+	if groupIdx < 0 {
+		value, err := aggregateCSV(q.Aggregate, rows, valueIdx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"value": value, "rows": len(rows)}, nil
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var results []map[string]any
+	for _, k := range keys {
+		value, err := aggregateCSV(q.Aggregate, groups[k], valueIdx)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, map[string]any{"group": k, "value": value, "rows": len(groups[k])})
+	}
+	return map[string]any{"groups": results}, nil
+}
+
+// openCSV only opens .csv files inside the sandbox directory (the working directory without -sandbox), the model must
+// not read arbitrary files like .env through this tool. the file is opened through os.Root, so a symlink in the
+// directory can't lead out of it either
+func openCSV(p string) (*os.File, error) {
+	if strings.TrimSpace(p) == "" {
+		return nil, errors.New("path is required")
+	}
+	if !strings.EqualFold(filepath.Ext(p), ".csv") {
+		return nil, fmt.Errorf("%s is not a .csv file", p)
+	}
+	dir, where := config.sandbox, "the sandbox directory"
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir, where = wd, "the working directory"
+	}
+	abs := p
+	if !filepath.IsAbs(p) {
+		abs = filepath.Join(dir, p)
+	}
+	rel, err := filepath.Rel(dir, filepath.Clean(abs))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside %s", p, where)
+	}
+	r, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //the opened file stays usable
+	f, err := r.Open(rel)
+	switch {
+	case err == nil:
+		return f, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("%s does not exist", p)
+	case strings.Contains(err.Error(), "escapes from parent"):
+		return nil, fmt.Errorf("%s leads outside %s", p, where)
+	}
+	return nil, err
+}
+
+// matchCSVCondition compares numerically when both sides are numbers, otherwise as case insensitive strings
+func matchCSVCondition(cell, op, value string) (bool, error) {
+	if !slices.Contains(csvOps, op) {
+		return false, fmt.Errorf("unsupported op %q", op)
+	}
+	cell, value = strings.TrimSpace(cell), strings.TrimSpace(value)
+	if op == "contains" {
+		return strings.Contains(strings.ToLower(cell), strings.ToLower(value)), nil
+	}
+
+	var cmp int
+	a, errA := strconv.ParseFloat(cell, 64)
+	b, errB := strconv.ParseFloat(value, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else if errB == nil && op != "=" && op != "!=" {
+		return false, nil //a numeric comparison never matches a non numeric cell
+	} else {
+		cmp = strings.Compare(strings.ToLower(cell), strings.ToLower(value))
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("unsupported op %q", op)
+}
+
+func aggregateCSV(op string, rows [][]string, idx int) (float64, error) {
+	if op == "count" {
+		return float64(len(rows)), nil
+	}
+	var values []float64
+	for _, row := range rows {
+		v, err := strconv.ParseFloat(strings.TrimSpace(row[idx]), 64)
+		if err != nil {
+			continue //empty or non numeric cells are skipped, like a spreadsheet would
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return 0, errors.New("no numeric values to aggregate")
+	}
+
+	switch op {
+	case "sum", "avg":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if op == "avg" {
+			return sum / float64(len(values)), nil
+		}
+		return sum, nil
+	case "min":
+		m := math.Inf(1)
+		for _, v := range values {
+			m = math.Min(m, v)
+		}
+		return m, nil
+	case "max":
+		m := math.Inf(-1)
+		for _, v := range values {
+			m = math.Max(m, v)
+		}
+		return m, nil
+	}
+	return 0, fmt.Errorf("unsupported aggregate %q", op)
+}
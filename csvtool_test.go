@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryCSV(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "sales.csv"), []byte("region,amount\nnorth,10\nsouth,5\nnorth,7\n"), 0o644)
+	os.WriteFile(filepath.Join(outside, "secret.csv"), []byte("key\nhunter2\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("OPENAI_API_KEY=hunter2\n"), 0o644)
+	if err := os.Symlink(filepath.Join(outside, "secret.csv"), filepath.Join(dir, "link.csv")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	big, _ := os.Create(filepath.Join(dir, "big.csv"))
+	big.Truncate(csvMaxBytes + 1)
+	big.Close()
+	t.Chdir(dir)
+
+	tests := []struct {
+		name, args string
+		want       string //a substring of the output
+	}{
+		{"sum by group", `{"path":"sales.csv","group_by":"region","aggregate":"sum","column":"amount"}`, `{"group":"north","rows":2,"value":17}`},
+		{"numeric filter", `{"path":"sales.csv","where":[{"column":"amount","op":">","value":"6"}],"aggregate":"count"}`, `"value":2`},
+		{"unknown column", `{"path":"sales.csv","aggregate":"sum","column":"price"}`, `unknown column`},
+		{"unsupported numeric op", `{"path":"sales.csv","where":[{"column":"region","op":"~","value":"3"}]}`, `unsupported op`},
+		{"parent directory", `{"path":"../x.csv"}`, `outside the working directory`},
+		{"absolute outside", `{"path":"` + filepath.Join(outside, "secret.csv") + `"}`, `outside the working directory`},
+		{"symlink out", `{"path":"link.csv"}`, `leads outside the working directory`},
+		{"too large", `{"path":"big.csv"}`, `larger than 16 MiB`},
+		{"missing", `{"path":"nope.csv"}`, `does not exist`},
+		{"not a csv", `{"path":".env"}`, `.env is not a .csv file`},
+		{"upper case extension", `{"path":"NOPE.CSV"}`, `does not exist`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := queryCSV(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !json.Valid([]byte(out)) || !strings.Contains(out, tt.want) {
+				t.Errorf("output %s, want it to contain %s", out, tt.want)
+			}
+			if strings.Contains(out, "hunter2") {
+				t.Errorf("output leaks the file outside the working directory: %s", out)
+			}
+		})
+	}
+}
+
+func TestQueryCSVSandbox(t *testing.T) {
+	sandbox, wd := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(sandbox, "data.csv"), []byte("n\n1\n2\n"), 0o644)
+	os.WriteFile(filepath.Join(wd, "secret.csv"), []byte("key\nhunter2\n"), 0o644)
+	t.Chdir(wd)
+	saved := config.sandbox
+	config.sandbox = sandbox
+	t.Cleanup(func() { config.sandbox = saved })
+
+	tests := []struct {
+		name, args string
+		want       string
+	}{
+		{"relative to the sandbox", `{"path":"data.csv","aggregate":"sum","column":"n"}`, `"value":3`},
+		{"absolute inside", `{"path":"` + filepath.Join(sandbox, "data.csv") + `","aggregate":"count"}`, `"value":2`},
+		{"working directory is out", `{"path":"` + filepath.Join(wd, "secret.csv") + `"}`, `outside the sandbox directory`},
+		{"not in the sandbox", `{"path":"secret.csv"}`, `does not exist`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := queryCSV(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out, tt.want) || strings.Contains(out, "hunter2") {
+				t.Errorf("output %s, want it to contain %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchCSVCondition(t *testing.T) {
+	tests := []struct {
+		cell, op, value string
+		want            bool
+		wantErr         bool
+	}{
+		{"10", ">", "9", true, false},
+		{"10", "<=", "9", false, false},
+		{"abc", ">", "9", false, false}, //a numeric comparison never matches text
+		{"North", "=", "north", true, false},
+		{"Northwest", "contains", "WEST", true, false},
+		{"10", "~", "9", false, true},
+		{"abc", "~", "9", false, true},
+		{"abc", "~", "x", false, true},
+	}
+	for _, tt := range tests {
+		got, err := matchCSVCondition(tt.cell, tt.op, tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("matchCSVCondition(%q, %q, %q) = %v, %v", tt.cell, tt.op, tt.value, got, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// -------------------------- DEADLINE WARNINGS --------------------------
+
+// once an operation used this fraction of its timeout we log a warning, so timeouts can be tuned before they become fatal errors
+const slowOperationThreshold = 0.8
+
+// opContext works like context.WithTimeout but also warns (with the operation name) when the operation gets close to its deadline.
+// the returned cancel func must be called like a normal cancel func, it also stops the watcher.
+func opContext(op string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	start := time.Now()
+
+	warnAfter := time.Duration(float64(timeout) * slowOperationThreshold)
+	timer := time.AfterFunc(warnAfter, func() {
+		slog.Warn("operation is close to its deadline",
+			"op", op,
+			"elapsed", time.Since(start).Round(time.Millisecond),
+			"timeout", timeout,
+		)
+	})
+
+	return ctx, func() {
+		timer.Stop()
+		cancel()
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// -------------------------- DICTATION (subcommand) --------------------------
+
+// spoken commands and the text they insert, scratchCommand removes the last dictated piece instead
+var dictationCommands = map[string]string{
+	"new paragraph": "\n\n",
+	"new line":      "\n",
+}
+
+const scratchCommand = "scratch that"
+
+// runDictate types transcribed speech into a file and/or the clipboard, interpreting the spoken editing commands
+func runDictate(args []string) error {
+	fs := flag.NewFlagSet("dictate", flag.ExitOnError)
+	opts := addTranscriptionFlags(fs)
+	outPath := fs.String("out", "", "file the dictated text is written to (rewritten after every sentence)")
+	copyCmd := fs.String("copy-cmd", "", `shell command that receives the whole text on stdin after every sentence, e.g. "pbcopy" or "xclip -selection clipboard"`)
+	if err := parseTranscriptionArgs(fs, opts, args); err != nil {
+		return err
+	}
+	if *outPath == "" && *copyCmd == "" {
+		return errors.New("give -out and/or -copy-cmd so the text goes somewhere")
+	}
+
+	var d dictation
+	return runTranscription(opts, func(segment string) error {
+		d.apply(segment)
+		text := d.String()
+		if *outPath != "" {
+			if err := os.WriteFile(*outPath, []byte(text), 0o644); err != nil {
+				return err
+			}
+		}
+		if *copyCmd != "" {
+			cmd := shellCommand(context.Background(), *copyCmd)
+			cmd.Stdin = strings.NewReader(text)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("copy command failed: %w: %s", err, out)
+			}
+		}
+		return nil
+	})
+}
+
+// dictation is the text built so far, kept as the pieces that were added so "scratch that" can undo the last one
+type dictation struct {
+	pieces []string
+}
+
+// apply splits a transcribed segment into sentences and either runs each one as a command or appends it as text
+func (d *dictation) apply(segment string) {
+	for _, sentence := range splitSentences(segment) {
+		cmd := normalizeCommand(sentence)
+		if cmd == scratchCommand {
+			if len(d.pieces) > 0 {
+				d.pieces = d.pieces[:len(d.pieces)-1]
+			}
+			continue
+		}
+		if insert, ok := dictationCommands[cmd]; ok {
+			d.pieces = append(d.pieces, insert)
+			continue
+		}
+		d.pieces = append(d.pieces, sentence)
+	}
+}
+
+func (d *dictation) String() string {
+	var b strings.Builder
+	for _, p := range d.pieces {
+		// sentences are separated by a space, unless we are at the start of the text or of a line
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") && !strings.HasPrefix(p, "\n") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// splitSentences cuts after every '.', '!' or '?' and trims the spaces around each sentence
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range text {
+		if r == '.' || r == '!' || r == '?' {
+			if s := strings.TrimSpace(text[start : i+1]); s != "" {
+				sentences = append(sentences, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// normalizeCommand lowercases and strips punctuation so "New paragraph." matches "new paragraph"
+func normalizeCommand(sentence string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, sentence)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+)
+
+// -------------------------- REVISION DIFF --------------------------
+
+const (
+	revisePrefix = "/revise"
+	// asked instead of the raw /revise text so the model rewrites its last answer instead of answering something new
+	revisePrompt = "Revise your previous answer as follows, and reply with the full revised answer only: "
+
+	ansiRed   = "\033[31;9m" //red + strikethrough
+	ansiGreen = "\033[32m"
+	ansiReset = "\033[0m"
+
+	// the LCS table is quadratic, above this many cells the sequences are not aligned
+	maxDiffCells = 4_000_000
+)
+
+// lcsPairs aligns two sequences of keys by their longest common subsequence: the matched indexes pair up and an index
+// only one side has pairs with -1, the one of a before the one of b that replaced it. false when a and b are too long
+func lcsPairs(a, b []string) ([][2]int, bool) {
+	if len(a)*len(b) > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var pairs [][2]int
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			pairs = append(pairs, [2]int{i, -1})
+			i++
+		default:
+			pairs = append(pairs, [2]int{-1, j})
+			j++
+		}
+	}
+	return pairs, true
+}
+
+// wordDiff renders the changes between two answers word by word: removed words in red, added words in green (marked without colors).
+// line breaks are tokens of their own, so lists, paragraphs and code keep their lines; a removed line break is marked with ↵
+func wordDiff(oldText, newText string) string {
+	a, b := diffTokens(oldText), diffTokens(newText)
+	pairs, ok := lcsPairs(a, b)
+	if !ok {
+		return newText
+	}
+	var out strings.Builder
+	lineStart := true
+	for _, p := range pairs {
+		token := ""
+		switch {
+		case p[1] < 0 && a[p[0]] == "\n":
+			token = removed("↵")
+		case p[1] < 0:
+			token = removed(a[p[0]])
+		case p[0] < 0 && b[p[1]] == "\n":
+			token = "\n"
+		case p[0] < 0:
+			token = added(b[p[1]])
+		default:
+			token = b[p[1]]
+		}
+		if token == "\n" {
+			out.WriteString(token)
+			lineStart = true
+			continue
+		}
+		if !lineStart {
+			out.WriteByte(' ')
+		}
+		out.WriteString(token)
+		lineStart = false
+	}
+	return out.String()
+}
+
+// diffTokens splits a text into its words and its line breaks, other runs of spaces and the blank lines around the text
+// don't count as changes
+func diffTokens(text string) []string {
+	var tokens []string
+	for i, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if i > 0 {
+			tokens = append(tokens, "\n")
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+	return tokens
+}
+
+// without colors the changes are marked the way git diff --word-diff=plain does
+func added(word string) string {
+	if !colors.enabled {
+		return "{+" + word + "+}"
+	}
+	return ansiGreen + word + ansiReset
+}
+
+func removed(word string) string {
+	if !colors.enabled {
+		return "[-" + word + "-]"
+	}
+	return ansiRed + word + ansiReset
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		old, new, want string
+	}{
+		{"the cat sat", "the cat sat", "the cat sat"},
+		{"the cat sat", "the dog sat", "the [-cat-] {+dog+} sat"},
+		{"a b c", "a c", "a [-b-] c"},
+		{"a c", "a b c", "a {+b+} c"},
+		{"", "new text", "{+new+} {+text+}"},
+		{"old  text\n", "old text", "old text"}, //whitespace is not a change
+		{"- one\n- two", "- one\n- three", "- one\n- [-two-] {+three+}"},
+		{"one\ntwo", "one\n\ntwo", "one\n\ntwo"},                               //an added blank line is shown as one
+		{"one\ntwo", "one two", "one [-↵-] two"},                               //a removed line break is marked
+		{"```\nx := 1\n```", "```\nx := 2\n```", "```\nx := [-1-] {+2+}\n```"}, //code keeps its lines
+	}
+	for _, tt := range tests {
+		if got := wordDiff(tt.old, tt.new); got != tt.want {
+			t.Errorf("wordDiff(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+
+	huge := strings.Repeat("w ", 2001)
+	if got := wordDiff(huge, huge+"x"); got != huge+"x" {
+		t.Error("answers over the LCS cap should come back as the new answer")
+	}
+}
+
+func TestAlignTurns(t *testing.T) {
+	turns := func(inputs ...string) []checkpointTurn {
+		var ts []checkpointTurn
+		for _, in := range inputs {
+			ts = append(ts, checkpointTurn{input: in})
+		}
+		return ts
+	}
+	tests := []struct {
+		name string
+		a, b []checkpointTurn
+		want [][2]int
+	}{
+		{"same", turns("hi", "2+2"), turns("hi", "2+2"), [][2]int{{0, 0}, {1, 1}}},
+		{"case and spaces", turns("Hello  there"), turns("hello there"), [][2]int{{0, 0}}},
+		{"added in b", turns("a", "c"), turns("a", "b", "c"), [][2]int{{0, 0}, {-1, 1}, {1, 2}}},
+		{"replaced", turns("a", "x", "c"), turns("a", "y", "c"), [][2]int{{0, 0}, {1, -1}, {-1, 1}, {2, 2}}},
+		{"empty a", nil, turns("a"), [][2]int{{-1, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alignTurns(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	long := make([]checkpointTurn, 2001)
+	got := alignTurns(long, long[:2000])
+	if len(got) != 2001 || got[1999] != [2]int{1999, 1999} || got[2000] != [2]int{2000, -1} {
+		t.Errorf("runs over the LCS cap should pair turn by turn, got %d pairs ending %v", len(got), got[len(got)-1])
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- ERROR MESSAGES --------------------------
+
+// describeHandshakeError turns the HTTP status of a failed websocket handshake into a message with a suggested fix
+func describeHandshakeError(resp *http.Response, err error) error {
+	if resp == nil {
+		return fmt.Errorf("could not reach the realtime endpoint (check your network/proxy): %w", err)
+	}
+	var hint string
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		hint = "authentication failed, check that OPENAI_API_KEY is a valid key"
+	case resp.StatusCode == http.StatusForbidden:
+		hint = "access denied, the key's project may not have realtime access or your region is not supported"
+	case resp.StatusCode == http.StatusNotFound:
+		hint = "endpoint or model not found, check the model name"
+	case resp.StatusCode == http.StatusTooManyRequests:
+		hint = "rate limited or out of quota, wait a bit or check your billing"
+	case resp.StatusCode >= 500:
+		hint = "OpenAI is having problems or is over capacity, try again later"
+	default:
+		return fmt.Errorf("websocket handshake failed: %s: %w", resp.Status, err)
+	}
+	err = fmt.Errorf("websocket handshake failed (%s): %s: %w", resp.Status, hint, err)
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return &keyError{err} //another key (or project) may still work
+	}
+	return err
+}
+
+// describeCloseError explains why the server (or the library) closed the connection, based on the websocket close code
+func describeCloseError(err error) error {
+	var ce websocket.CloseError
+	if !errors.As(err, &ce) {
+		return err
+	}
+	var hint string
+	switch ce.Code {
+	case websocket.StatusNormalClosure:
+		hint = "the server closed the session"
+	case websocket.StatusGoingAway:
+		hint = "the server is going away (restart or session time limit), start a new session"
+	case websocket.StatusPolicyViolation:
+		hint = "the server rejected the session (usually an invalid key, model or request)"
+	case websocket.StatusMessageTooBig:
+		hint = "a message was larger than the read limit, raise " + readLimitEnvVar
+	case websocket.StatusInternalError:
+		hint = "the server hit an internal error, try again"
+	case websocket.StatusTryAgainLater:
+		hint = "the server is over capacity, try again later"
+	default:
+		return fmt.Errorf("connection closed: %w", err)
+	}
+	return fmt.Errorf("connection closed: %s: %w", hint, err)
+}
+
+// describeServerError formats an "error" event from the server, adding a suggested fix for the codes we know about
+func describeServerError(evt map[string]any) error {
+	errObj, _ := evt["error"].(map[string]any)
+	code, _ := errObj["code"].(string)
+	msg, _ := errObj["message"].(string)
+	if msg == "" {
+		b, _ := json.Marshal(evt)
+		msg = string(b)
+	}
+
+	var hint string
+	switch code {
+	case "invalid_api_key":
+		hint = "check OPENAI_API_KEY"
+	case "model_not_found":
+		hint = "check the model name"
+	case "unsupported_country_region_territory":
+		hint = "the API is not available in your region"
+	case "insufficient_quota":
+		hint = "your account is out of credit, check your billing"
+	case "rate_limit_exceeded":
+		hint = "you are sending requests too fast, wait a bit"
+	case "session_expired":
+		hint = "the realtime session hit its time limit, start a new one"
+	}
+	if hint == "" {
+		return fmt.Errorf("server error: %s", msg)
+	}
+	err := fmt.Errorf("server error: %s (%s)", msg, hint)
+	switch code {
+	case "invalid_api_key", "insufficient_quota", "rate_limit_exceeded":
+		return &keyError{err}
+	}
+	return err
+}
+
+// sessionError prefers the reason the reader stopped (if it already reported one) over a generic "channel closed" error
+func sessionError(errs <-chan error, err error) error {
+	select {
+	case readErr, ok := <-errs:
+		if ok && readErr != nil {
+			return readErr
+		}
+	default:
+	}
+	return err
+}
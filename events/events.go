@@ -0,0 +1,451 @@
+// Package events has typed payloads and constructors for the client events of the OpenAI Realtime API,
+// so callers don't have to build the nested JSON objects by hand.
+// Every constructor validates its input and returns a value that can be passed straight to json.Marshal.
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// client event types (https://platform.openai.com/docs/api-reference/realtime-client-events)
+const (
+	TypeSessionUpdate            = "session.update"
+	TypeInputAudioBufferAppend   = "input_audio_buffer.append"
+	TypeInputAudioBufferCommit   = "input_audio_buffer.commit"
+	TypeInputAudioBufferClear    = "input_audio_buffer.clear"
+	TypeConversationItemCreate   = "conversation.item.create"
+	TypeConversationItemTruncate = "conversation.item.truncate"
+	TypeConversationItemDelete   = "conversation.item.delete"
+	TypeResponseCreate           = "response.create"
+	TypeResponseCancel           = "response.cancel"
+
+	TypeTranscriptionSessionUpdate = "transcription_session.update"
+)
+
+// modalities accepted by session.update and response.create
+const (
+	ModalityText  = "text"
+	ModalityAudio = "audio"
+)
+
+// -------------------------- session.update --------------------------
+
+// Tool is a function tool the model is allowed to call.
+type Tool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"` // JSON schema of the arguments
+}
+
+// FunctionTool returns a Tool of type "function".
+func FunctionTool(name, description string, parameters any) Tool {
+	return Tool{Type: "function", Name: name, Description: description, Parameters: parameters}
+}
+
+// Session holds the session fields to update, empty fields are left out so the server keeps their current value.
+type Session struct {
+	Modalities   []string `json:"modalities,omitempty"`
+	Instructions string   `json:"instructions,omitempty"`
+	Voice        string   `json:"voice,omitempty"`
+	Tools        []Tool   `json:"tools,omitempty"`
+	ToolChoice   string   `json:"tool_choice,omitempty"` // auto, none or required
+
+	Temperature             float64   `json:"temperature,omitempty"`
+	MaxResponseOutputTokens MaxTokens `json:"max_response_output_tokens,omitempty"`
+
+	InputAudioFormat  string `json:"input_audio_format,omitempty"`
+	OutputAudioFormat string `json:"output_audio_format,omitempty"`
+
+	TurnDetection *TurnDetection `json:"turn_detection,omitempty"`
+}
+
+// tool choices accepted by session.update
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// audio formats accepted for the input and output audio
+const (
+	AudioFormatPCM16    = "pcm16"
+	AudioFormatG711ULaw = "g711_ulaw"
+	AudioFormatG711ALaw = "g711_alaw"
+)
+
+// the sampling temperature range the realtime models accept
+const (
+	MinTemperature = 0.6
+	MaxTemperature = 1.2
+)
+
+// MaxTokens caps the output tokens of a response, zero keeps the server value and MaxTokensInf lifts the cap.
+type MaxTokens int
+
+const MaxTokensInf MaxTokens = -1
+
+// MarshalJSON sends MaxTokensInf as "inf", which is how the API spells no limit.
+func (m MaxTokens) MarshalJSON() ([]byte, error) {
+	if m == MaxTokensInf {
+		return []byte(`"inf"`), nil
+	}
+	return json.Marshal(int(m))
+}
+
+type SessionUpdate struct {
+	Type    string  `json:"type"`
+	Session Session `json:"session"`
+}
+
+// NewSessionUpdate validates the modalities, turn detection and tools (function tools need a unique name) and builds a session.update event.
+func NewSessionUpdate(session Session) (SessionUpdate, error) {
+	if err := validateModalities(session.Modalities); err != nil {
+		return SessionUpdate{}, err
+	}
+	if err := validateTurnDetection(session.TurnDetection); err != nil {
+		return SessionUpdate{}, err
+	}
+	if err := validateSessionSettings(session); err != nil {
+		return SessionUpdate{}, err
+	}
+	seen := map[string]bool{}
+	for _, t := range session.Tools {
+		if t.Type != "function" {
+			return SessionUpdate{}, fmt.Errorf("tool %q: unsupported type %q", t.Name, t.Type)
+		}
+		if t.Name == "" {
+			return SessionUpdate{}, errors.New("tool without a name")
+		}
+		if seen[t.Name] {
+			return SessionUpdate{}, fmt.Errorf("tool %q registered twice", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return SessionUpdate{Type: TypeSessionUpdate, Session: session}, nil
+}
+
+func validateSessionSettings(session Session) error {
+	if err := validateSampling(session.Temperature, session.MaxResponseOutputTokens); err != nil {
+		return err
+	}
+	switch session.ToolChoice {
+	case "", ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+	default:
+		return fmt.Errorf("unsupported tool choice %q", session.ToolChoice)
+	}
+	for _, f := range []string{session.InputAudioFormat, session.OutputAudioFormat} {
+		switch f {
+		case "", AudioFormatPCM16, AudioFormatG711ULaw, AudioFormatG711ALaw:
+		default:
+			return fmt.Errorf("unsupported audio format %q", f)
+		}
+	}
+	return nil
+}
+
+// SessionConfig builds a session.update one setting at a time, Build validates it like NewSessionUpdate.
+//
+//	update, err := events.NewSessionConfig().Instructions("be brief").Temperature(0.8).Tools(tools...).Build()
+type SessionConfig struct {
+	session Session
+}
+
+func NewSessionConfig() *SessionConfig { return &SessionConfig{} }
+
+func (c *SessionConfig) Instructions(instructions string) *SessionConfig {
+	c.session.Instructions = instructions
+	return c
+}
+
+func (c *SessionConfig) Voice(voice string) *SessionConfig {
+	c.session.Voice = voice
+	return c
+}
+
+func (c *SessionConfig) Temperature(temperature float64) *SessionConfig {
+	c.session.Temperature = temperature
+	return c
+}
+
+// MaxResponseOutputTokens caps every response of the session, MaxTokensInf removes the cap.
+func (c *SessionConfig) MaxResponseOutputTokens(max MaxTokens) *SessionConfig {
+	c.session.MaxResponseOutputTokens = max
+	return c
+}
+
+func (c *SessionConfig) Modalities(modalities ...string) *SessionConfig {
+	c.session.Modalities = modalities
+	return c
+}
+
+func (c *SessionConfig) Tools(tools ...Tool) *SessionConfig {
+	c.session.Tools = tools
+	return c
+}
+
+func (c *SessionConfig) ToolChoice(choice string) *SessionConfig {
+	c.session.ToolChoice = choice
+	return c
+}
+
+func (c *SessionConfig) InputAudioFormat(format string) *SessionConfig {
+	c.session.InputAudioFormat = format
+	return c
+}
+
+func (c *SessionConfig) OutputAudioFormat(format string) *SessionConfig {
+	c.session.OutputAudioFormat = format
+	return c
+}
+
+func (c *SessionConfig) TurnDetection(turnDetection *TurnDetection) *SessionConfig {
+	c.session.TurnDetection = turnDetection
+	return c
+}
+
+// Build validates the collected settings and returns the single session.update that carries them all.
+func (c *SessionConfig) Build() (SessionUpdate, error) {
+	return NewSessionUpdate(c.session)
+}
+
+// -------------------------- turn detection --------------------------
+
+// turn detection modes, with TurnDetectionNone the client ends every turn itself with input_audio_buffer.commit
+const (
+	TurnDetectionServerVAD = "server_vad"
+	TurnDetectionNone      = "none"
+)
+
+// TurnDetection configures how the server decides that the user stopped speaking, zero fields keep the server defaults.
+type TurnDetection struct {
+	Type              string  `json:"type"`
+	Threshold         float64 `json:"threshold,omitempty"`           // 0..1, higher needs louder audio to count as speech
+	PrefixPaddingMs   int     `json:"prefix_padding_ms,omitempty"`   // audio kept from before the speech started
+	SilenceDurationMs int     `json:"silence_duration_ms,omitempty"` // silence that ends the turn
+}
+
+// MarshalJSON sends TurnDetectionNone as null, which is how the API turns detection off.
+func (t TurnDetection) MarshalJSON() ([]byte, error) {
+	if t.Type == TurnDetectionNone {
+		return []byte("null"), nil
+	}
+	type plain TurnDetection
+	return json.Marshal(plain(t))
+}
+
+func validateTurnDetection(t *TurnDetection) error {
+	if t == nil {
+		return nil
+	}
+	switch t.Type {
+	case TurnDetectionNone:
+		return nil
+	case TurnDetectionServerVAD:
+	default:
+		return fmt.Errorf("unsupported turn detection %q", t.Type)
+	}
+	if t.Threshold < 0 || t.Threshold > 1 {
+		return fmt.Errorf("turn detection threshold must be between 0 and 1, got %g", t.Threshold)
+	}
+	if t.PrefixPaddingMs < 0 || t.SilenceDurationMs < 0 {
+		return errors.New("turn detection durations can't be negative")
+	}
+	return nil
+}
+
+// -------------------------- transcription_session.update --------------------------
+
+// Transcription selects the model (and optionally the language) used to transcribe input audio.
+type Transcription struct {
+	Model    string `json:"model"`
+	Language string `json:"language,omitempty"` // ISO-639-1, empty lets the model detect it
+	Prompt   string `json:"prompt,omitempty"`
+}
+
+// TranscriptionSession is the config of a transcription-only session (no model responses are generated).
+type TranscriptionSession struct {
+	InputAudioFormat        string         `json:"input_audio_format,omitempty"`
+	InputAudioTranscription Transcription  `json:"input_audio_transcription"`
+	TurnDetection           *TurnDetection `json:"turn_detection,omitempty"`
+}
+
+type TranscriptionSessionUpdate struct {
+	Type    string               `json:"type"`
+	Session TranscriptionSession `json:"session"`
+}
+
+// NewTranscriptionSessionUpdate builds a transcription_session.update event, a transcription model is required.
+func NewTranscriptionSessionUpdate(session TranscriptionSession) (TranscriptionSessionUpdate, error) {
+	if session.InputAudioTranscription.Model == "" {
+		return TranscriptionSessionUpdate{}, errors.New("transcription session without a transcription model")
+	}
+	if err := validateTurnDetection(session.TurnDetection); err != nil {
+		return TranscriptionSessionUpdate{}, err
+	}
+	return TranscriptionSessionUpdate{Type: TypeTranscriptionSessionUpdate, Session: session}, nil
+}
+
+// -------------------------- input_audio_buffer.* --------------------------
+
+type InputAudioAppend struct {
+	Type  string `json:"type"`
+	Audio string `json:"audio"` // base64 encoded audio in the session input format
+}
+
+// NewInputAudioAppend base64 encodes a chunk of raw audio (PCM16 by default) into an input_audio_buffer.append event.
+func NewInputAudioAppend(audio []byte) (InputAudioAppend, error) {
+	if len(audio) == 0 {
+		return InputAudioAppend{}, errors.New("empty audio chunk")
+	}
+	return InputAudioAppend{Type: TypeInputAudioBufferAppend, Audio: base64.StdEncoding.EncodeToString(audio)}, nil
+}
+
+// TypeOnly is used for the events that have no fields except their type.
+type TypeOnly struct {
+	Type string `json:"type"`
+}
+
+func NewInputAudioCommit() TypeOnly { return TypeOnly{Type: TypeInputAudioBufferCommit} }
+
+func NewInputAudioClear() TypeOnly { return TypeOnly{Type: TypeInputAudioBufferClear} }
+
+// -------------------------- conversation.item.* --------------------------
+
+// ContentPart is a single part of a message item.
+type ContentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// Item is a conversation item: a message (role + content) or the output of a function call (call id + output).
+type Item struct {
+	Type    string        `json:"type"`
+	Role    string        `json:"role,omitempty"`
+	Content []ContentPart `json:"content,omitempty"`
+	CallID  string        `json:"call_id,omitempty"`
+	Output  string        `json:"output,omitempty"`
+}
+
+// UserText returns a user message item with a single input_text part.
+func UserText(text string) Item {
+	return Item{Type: "message", Role: "user", Content: []ContentPart{{Type: "input_text", Text: text}}}
+}
+
+// AssistantText returns an assistant message item, used to put earlier answers back into a new conversation.
+func AssistantText(text string) Item {
+	return Item{Type: "message", Role: "assistant", Content: []ContentPart{{Type: "text", Text: text}}}
+}
+
+// FunctionCallOutput returns the item that hands the result of a function call back to the model.
+func FunctionCallOutput(callID, output string) Item {
+	return Item{Type: "function_call_output", CallID: callID, Output: output}
+}
+
+type ConversationItemCreate struct {
+	Type string `json:"type"`
+	Item Item   `json:"item"`
+}
+
+// NewConversationItemCreate validates the item and builds a conversation.item.create event.
+func NewConversationItemCreate(item Item) (ConversationItemCreate, error) {
+	switch item.Type {
+	case "message":
+		if item.Role != "user" && item.Role != "assistant" && item.Role != "system" {
+			return ConversationItemCreate{}, fmt.Errorf("message item: invalid role %q", item.Role)
+		}
+		if len(item.Content) == 0 {
+			return ConversationItemCreate{}, errors.New("message item without content")
+		}
+	case "function_call_output":
+		if item.CallID == "" {
+			return ConversationItemCreate{}, errors.New("function_call_output item without call_id")
+		}
+	default:
+		return ConversationItemCreate{}, fmt.Errorf("unsupported item type %q", item.Type)
+	}
+	return ConversationItemCreate{Type: TypeConversationItemCreate, Item: item}, nil
+}
+
+type ConversationItemTruncate struct {
+	Type         string `json:"type"`
+	ItemID       string `json:"item_id"`
+	ContentIndex int    `json:"content_index"`
+	AudioEndMs   int    `json:"audio_end_ms"`
+}
+
+// NewConversationItemTruncate builds a conversation.item.truncate event for the audio of an assistant message.
+func NewConversationItemTruncate(itemID string, contentIndex, audioEndMs int) (ConversationItemTruncate, error) {
+	if itemID == "" {
+		return ConversationItemTruncate{}, errors.New("truncate without item_id")
+	}
+	if contentIndex < 0 || audioEndMs < 0 {
+		return ConversationItemTruncate{}, errors.New("truncate with a negative index")
+	}
+	return ConversationItemTruncate{Type: TypeConversationItemTruncate, ItemID: itemID, ContentIndex: contentIndex, AudioEndMs: audioEndMs}, nil
+}
+
+type ConversationItemDelete struct {
+	Type   string `json:"type"`
+	ItemID string `json:"item_id"`
+}
+
+// NewConversationItemDelete builds a conversation.item.delete event.
+func NewConversationItemDelete(itemID string) (ConversationItemDelete, error) {
+	if itemID == "" {
+		return ConversationItemDelete{}, errors.New("delete without item_id")
+	}
+	return ConversationItemDelete{Type: TypeConversationItemDelete, ItemID: itemID}, nil
+}
+
+// -------------------------- response.* --------------------------
+
+// Response holds the per-response overrides sent with response.create, zero values keep the session settings.
+type Response struct {
+	Modalities   []string `json:"modalities,omitempty"`
+	Instructions string   `json:"instructions,omitempty"`
+
+	Temperature             float64   `json:"temperature,omitempty"`
+	MaxResponseOutputTokens MaxTokens `json:"max_response_output_tokens,omitempty"`
+}
+
+type ResponseCreate struct {
+	Type     string   `json:"type"`
+	Response Response `json:"response"`
+}
+
+// NewResponseCreate validates the modalities, temperature and token cap and builds a response.create event.
+func NewResponseCreate(response Response) (ResponseCreate, error) {
+	if err := validateModalities(response.Modalities); err != nil {
+		return ResponseCreate{}, err
+	}
+	if err := validateSampling(response.Temperature, response.MaxResponseOutputTokens); err != nil {
+		return ResponseCreate{}, err
+	}
+	return ResponseCreate{Type: TypeResponseCreate, Response: response}, nil
+}
+
+func NewResponseCancel() TypeOnly { return TypeOnly{Type: TypeResponseCancel} }
+
+func validateModalities(modalities []string) error {
+	for _, m := range modalities {
+		if m != ModalityText && m != ModalityAudio {
+			return fmt.Errorf("unsupported modality %q", m)
+		}
+	}
+	return nil
+}
+
+// validateSampling checks a temperature and a token cap, zero leaves them unset
+func validateSampling(temperature float64, maxTokens MaxTokens) error {
+	if temperature != 0 && (temperature < MinTemperature || temperature > MaxTemperature) {
+		return fmt.Errorf("temperature must be between %g and %g, got %g", MinTemperature, MaxTemperature, temperature)
+	}
+	if maxTokens < 0 && maxTokens != MaxTokensInf {
+		return fmt.Errorf("max output tokens can't be negative, got %d", maxTokens)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func marshal(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMaxTokensJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"inf", MaxTokensInf, `"inf"`},
+		{"number", MaxTokens(4096), `4096`},
+		{"zero alone", MaxTokens(0), `0`},
+		{"zero is left out", Response{Instructions: "hi"}, `{"instructions":"hi"}`},
+		{"inf in a response", Response{MaxResponseOutputTokens: MaxTokensInf}, `{"max_response_output_tokens":"inf"}`},
+		{"cap in a session", Session{MaxResponseOutputTokens: 256}, `{"max_response_output_tokens":256}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marshal(t, tt.v); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTurnDetectionJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		td   *TurnDetection
+		want string
+	}{
+		{"left out", nil, `{}`},
+		{"none is null", &TurnDetection{Type: TurnDetectionNone, Threshold: 0.5}, `{"turn_detection":null}`},
+		{"server vad defaults", &TurnDetection{Type: TurnDetectionServerVAD}, `{"turn_detection":{"type":"server_vad"}}`},
+		{
+			"server vad tuned",
+			&TurnDetection{Type: TurnDetectionServerVAD, Threshold: 0.7, PrefixPaddingMs: 300, SilenceDurationMs: 800},
+			`{"turn_detection":{"type":"server_vad","threshold":0.7,"prefix_padding_ms":300,"silence_duration_ms":800}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marshal(t, Session{TurnDetection: tt.td}); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSampling(t *testing.T) {
+	tests := []struct {
+		temperature float64
+		maxTokens   MaxTokens
+		wantErr     string //empty when valid
+	}{
+		{0, 0, ""}, //both unset
+		{MinTemperature, 100, ""},
+		{MaxTemperature, MaxTokensInf, ""},
+		{0.8, 0, ""},
+		{0.59, 0, "temperature must be between 0.6 and 1.2"},
+		{1.21, 0, "temperature must be between 0.6 and 1.2"},
+		{-0.8, 0, "temperature must be between"},
+		{0, -2, "max output tokens can't be negative"},
+	}
+	for _, tt := range tests {
+		err := validateSampling(tt.temperature, tt.maxTokens)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("validateSampling(%g, %d) = %v, want no error", tt.temperature, tt.maxTokens, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("validateSampling(%g, %d) = %v, want %q", tt.temperature, tt.maxTokens, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSessionConfigBuild(t *testing.T) {
+	multiply := FunctionTool("multiply", "Multiply two numbers.", map[string]any{"type": "object"})
+	tests := []struct {
+		name    string
+		config  *SessionConfig
+		want    string //the JSON of the event
+		wantErr string
+	}{
+		{
+			name:   "empty",
+			config: NewSessionConfig(),
+			want:   `{"type":"session.update","session":{}}`,
+		},
+		{
+			name: "every setting",
+			config: NewSessionConfig().
+				Modalities(ModalityText, ModalityAudio).
+				Instructions("be brief").
+				Voice("alloy").
+				Tools(multiply).
+				ToolChoice(ToolChoiceAuto).
+				Temperature(0.8).
+				MaxResponseOutputTokens(MaxTokensInf).
+				InputAudioFormat(AudioFormatPCM16).
+				OutputAudioFormat(AudioFormatG711ULaw).
+				TurnDetection(&TurnDetection{Type: TurnDetectionNone}),
+			want: `{"type":"session.update","session":{"modalities":["text","audio"],"instructions":"be brief","voice":"alloy",` +
+				`"tools":[{"type":"function","name":"multiply","description":"Multiply two numbers.","parameters":{"type":"object"}}],` +
+				`"tool_choice":"auto","temperature":0.8,"max_response_output_tokens":"inf","input_audio_format":"pcm16",` +
+				`"output_audio_format":"g711_ulaw","turn_detection":null}}`,
+		},
+		{
+			name:   "a later call replaces the value",
+			config: NewSessionConfig().Instructions("first").Instructions("second"),
+			want:   `{"type":"session.update","session":{"instructions":"second"}}`,
+		},
+		{name: "temperature out of range", config: NewSessionConfig().Temperature(2), wantErr: "temperature"},
+		{name: "modality", config: NewSessionConfig().Modalities("video"), wantErr: `unsupported modality "video"`},
+		{name: "tool choice", config: NewSessionConfig().ToolChoice("sometimes"), wantErr: "unsupported tool choice"},
+		{name: "audio format", config: NewSessionConfig().OutputAudioFormat("mp3"), wantErr: `unsupported audio format "mp3"`},
+		{name: "tool twice", config: NewSessionConfig().Tools(multiply, multiply), wantErr: "registered twice"},
+		{name: "tool without name", config: NewSessionConfig().Tools(FunctionTool("", "", nil)), wantErr: "without a name"},
+		{name: "tool type", config: NewSessionConfig().Tools(Tool{Type: "code", Name: "x"}), wantErr: "unsupported type"},
+		{
+			name:    "turn detection threshold",
+			config:  NewSessionConfig().TurnDetection(&TurnDetection{Type: TurnDetectionServerVAD, Threshold: 1.5}),
+			wantErr: "threshold must be between 0 and 1",
+		},
+		{
+			name:    "turn detection type",
+			config:  NewSessionConfig().TurnDetection(&TurnDetection{Type: "semantic"}),
+			wantErr: "unsupported turn detection",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := tt.config.Build()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := marshal(t, update); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
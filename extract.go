@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------------- STREAMING EXTRACTORS (-extract) --------------------------
+
+// -extract name=regex runs the regex over the answer while it streams and reports every match as soon as it is complete,
+// so side effects (opening a ticket, checking a link) don't wait for response.done
+
+// extraction is one match, the JSON lines of -extract-out have this shape
+type extraction struct {
+	Time      time.Time         `json:"time"`
+	Extractor string            `json:"extractor"`
+	Match     string            `json:"match"`
+	Groups    map[string]string `json:"groups,omitempty"` //the named groups of the regex
+}
+
+type extractor struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// extractorSet holds the extractors and the callbacks every match goes to. a nil set extracts nothing
+type extractorSet struct {
+	extractors []extractor
+	mu         sync.Mutex
+	sinks      []func(extraction)
+}
+
+var extractors *extractorSet
+
+// parseExtractor parses the value of -extract, "name=regex"
+func parseExtractor(spec string) (extractor, error) {
+	name, pattern, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || pattern == "" {
+		return extractor{}, fmt.Errorf("expected name=regex, got %q", spec)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return extractor{}, fmt.Errorf("extractor %s: %w", name, err)
+	}
+	if re.MatchString("") {
+		return extractor{}, fmt.Errorf("extractor %s: the regex matches the empty string", name)
+	}
+	return extractor{name: name, re: re}, nil
+}
+
+// newExtractorSet reports the matches as JSON lines to outPath, or to the log when it is not set
+// (at debug level with a file, the log lines land in the middle of the streamed answer)
+func newExtractorSet(list []extractor, outPath string) (*extractorSet, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	set := &extractorSet{extractors: list}
+	level := slog.LevelInfo
+	if outPath != "" {
+		level = slog.LevelDebug
+	}
+	set.onMatch(func(e extraction) {
+		slog.Log(context.Background(), level, "extracted", "extractor", e.Extractor, "match", e.Match)
+	})
+	if outPath != "" {
+		f, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f) //left open for the whole run, every line is written as it comes
+		set.onMatch(func(e extraction) {
+			if err := enc.Encode(e); err != nil {
+				slog.Error("extract: writing a match", "path", outPath, "err", err)
+			}
+		})
+	}
+	return set, nil
+}
+
+// onMatch registers a callback, it is called on the stream's goroutine so it should return quickly
+func (s *extractorSet) onMatch(sink func(extraction)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sinks = append(s.sinks, sink)
+}
+
+func (s *extractorSet) emit(e extraction) {
+	s.mu.Lock()
+	sinks := s.sinks
+	s.mu.Unlock()
+	for _, sink := range sinks {
+		sink(e)
+	}
+}
+
+// extractScan follows the text of one message. a match is final once some text follows it (a URL may still be
+// growing while it ends the text), the end of the message makes the rest final
+type extractScan struct {
+	set  *extractorSet
+	text strings.Builder
+	next []int //per extractor, where its next search starts
+}
+
+func (s *extractorSet) newScan() *extractScan {
+	if s == nil {
+		return nil
+	}
+	return &extractScan{set: s, next: make([]int, len(s.extractors))}
+}
+
+func (sc *extractScan) feed(delta string) {
+	if sc == nil {
+		return
+	}
+	sc.text.WriteString(delta)
+	sc.scan(false)
+}
+
+// flush ends the message and starts the next one clean
+func (sc *extractScan) flush() {
+	if sc == nil {
+		return
+	}
+	sc.scan(true)
+	sc.text.Reset()
+	clear(sc.next)
+}
+
+func (sc *extractScan) scan(final bool) {
+	text := sc.text.String()
+	for i, ex := range sc.set.extractors {
+		for sc.next[i] < len(text) {
+			loc := ex.re.FindStringSubmatchIndex(text[sc.next[i]:])
+			if loc == nil {
+				break
+			}
+			start, end := sc.next[i]+loc[0], sc.next[i]+loc[1]
+			if end == len(text) && !final {
+				break //might grow with the next delta
+			}
+			sc.set.emit(extraction{Time: time.Now(), Extractor: ex.name, Match: text[start:end], Groups: namedGroups(ex.re, text[sc.next[i]:], loc)})
+			sc.next[i] = end
+		}
+	}
+}
+
+func namedGroups(re *regexp.Regexp, text string, loc []int) map[string]string {
+	var groups map[string]string
+	for i, name := range re.SubexpNames() {
+		if name == "" || loc[2*i] < 0 {
+			continue
+		}
+		if groups == nil {
+			groups = map[string]string{}
+		}
+		groups[name] = text[loc[2*i]:loc[2*i+1]]
+	}
+	return groups
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// -------------------------- fetch_url TOOL --------------------------
+
+const (
+	fetchInstructions = " When the user asks about a web page or live content on the web, use the fetch_url tool instead of answering from memory."
+	fetchTimeout      = 15 * time.Second
+	fetchDownloadMax  = 1 << 20  //bytes read from one response, the rest is not downloaded
+	fetchBodyMax      = 32 << 10 //bytes of text sent back to the model
+	fetchChunk        = 32 << 10 //the fetch budget is reserved chunk by chunk while reading, the unread part of a chunk is refunded
+	// the model can be talked into fetching internal addresses by the pages it reads, so they are refused unless this is 1
+	fetchPrivateEnvVar = "REALTIME_CLI_FETCH_PRIVATE"
+)
+
+var fetchURLTool = Tool{
+	Name:        "fetch_url",
+	Description: "Download a web page or file with an HTTP GET and return its text (HTML is reduced to text, long bodies are cut).",
+	JSONSchema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"url": map[string]any{"type": "string", "description": "absolute http or https URL"},
+		},
+		"required": []string{"url"},
+	},
+	Handler: func(ctx context.Context, argsJSON string) (string, error) {
+		var args struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("bad fetch_url args: %w", err)
+		}
+		result, err := fetchURL(ctx, args.URL)
+		if err != nil {
+			result = map[string]any{"error": err.Error()}
+		}
+		out, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	},
+}
+
+var fetchClient = &http.Client{
+	Timeout: fetchTimeout,
+	Transport: &http.Transport{
+		Proxy:               nil, //direct connections only, so the address check sees the real server and not a proxy
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: refusePrivateAddresses}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to a %s URL", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// refusePrivateAddresses runs after DNS resolution, so a public name pointing at an internal address is caught too
+func refusePrivateAddresses(_, address string, _ syscall.RawConn) error {
+	if os.Getenv(fetchPrivateEnvVar) == "1" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%s is a local or private address (set %s=1 to allow it)", host, fetchPrivateEnvVar)
+	}
+	return nil
+}
+
+func fetchURL(ctx context.Context, raw string) (map[string]any, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute http or https URL", raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html, text/plain, application/json;q=0.9, */*;q=0.5")
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, complete, err := readFetchBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	text := string(body)
+	if strings.Contains(contentType, "html") {
+		text = htmlToText(text)
+	}
+	truncated := !complete
+	if len(text) > fetchBodyMax {
+		text, truncated = strings.ToValidUTF8(text[:fetchBodyMax], ""), true
+	}
+	return map[string]any{
+		"url":          resp.Request.URL.String(), //after redirects
+		"status":       resp.StatusCode,
+		"content_type": contentType,
+		"body":         text,
+		"truncated":    truncated,
+	}, nil
+}
+
+// readFetchBody reads up to fetchDownloadMax bytes, taking every chunk out of the session fetch budget first
+func readFetchBody(r io.Reader) ([]byte, bool, error) {
+	var body []byte
+	buf := make([]byte, fetchChunk)
+	for len(body) < fetchDownloadMax {
+		if err := limits.reserveFetch(fetchChunk); err != nil {
+			if len(body) == 0 {
+				return nil, false, err
+			}
+			return body, false, nil //what was read still helps
+		}
+		n, err := io.ReadFull(r, buf)
+		limits.refundFetch(int64(fetchChunk - n))
+		body = append(body, buf[:n]...)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return body, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return body, false, nil
+}
+
+var (
+	htmlDropped = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head)\b.*?</(script|style|noscript|svg|head)>|<!--.*?-->`)
+	htmlBreaks  = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr|/title)\b[^>]*>`)
+	htmlTags    = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankRuns   = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLines  = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// htmlToText is a rough reduction of a page to its readable text, enough for the model and much smaller than the markup
+func htmlToText(s string) string {
+	s = htmlDropped.ReplaceAllString(s, " ")
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = blankRuns.ReplaceAllString(s, " ")
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadFetchBodyBudget(t *testing.T) {
+	limits = &toolLimits{fetchBytes: 3 * fetchChunk}
+	t.Cleanup(func() { limits = nil })
+
+	for range 10 { //short pages cost their size, ten of them fit in a budget of three chunks
+		body, complete, err := readFetchBody(strings.NewReader("<p>hello</p>"))
+		if err != nil || !complete || string(body) != "<p>hello</p>" {
+			t.Fatalf("got %q, %v, %v", body, complete, err)
+		}
+	}
+	if want := int64(10 * len("<p>hello</p>")); limits.fetched != want {
+		t.Errorf("charged %d bytes, want %d", limits.fetched, want)
+	}
+
+	body, complete, err := readFetchBody(strings.NewReader(strings.Repeat("x", 5*fetchChunk)))
+	if err != nil || complete || len(body) != 2*fetchChunk {
+		t.Errorf("a page over the budget: got %d bytes, complete %v, %v; want the 2 chunks that fit", len(body), complete, err)
+	}
+	if _, _, err := readFetchBody(strings.NewReader("more")); err == nil {
+		t.Error("the budget is used up, the next fetch should fail")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// -------------------------- read_file / write_file TOOLS (sandboxed) --------------------------
+
+// both tools only exist with -sandbox, and every path is resolved inside that directory through os.Root,
+// so "..", absolute paths and symlinks pointing out of it are refused by the OS and not by string checks
+const (
+	fileReadMax  = 64 << 10  //bytes of a file sent back to the model, the rest is cut
+	fileWriteMax = 256 << 10 //largest content the model may write in one call
+)
+
+func readFileTool(root string) Tool {
+	return Tool{
+		Name:        "read_file",
+		Description: "Read a text file from the user's sandbox directory. Long files are cut, the result says so.",
+		JSONSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string", "description": "path relative to the sandbox directory, e.g. notes/todo.md"},
+			},
+			"required": []string{"path"},
+		},
+		Handler: func(_ context.Context, argsJSON string) (string, error) {
+			var args struct {
+				Path string `json:"path"`
+			}
+			if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+				return "", fmt.Errorf("bad read_file args: %w", err)
+			}
+			return fileToolOutput(readSandboxFile(root, args.Path))
+		},
+	}
+}
+
+func writeFileTool(root string) Tool {
+	return Tool{
+		Name: "write_file",
+		Description: "Write a text file in the user's sandbox directory, creating missing parent directories. " +
+			"An existing file is only replaced when overwrite is true, append adds to its end instead.",
+		JSONSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path":      map[string]any{"type": "string", "description": "path relative to the sandbox directory"},
+				"content":   map[string]any{"type": "string"},
+				"overwrite": map[string]any{"type": "boolean", "description": "replace the file if it exists"},
+				"append":    map[string]any{"type": "boolean", "description": "add the content to the end of the file"},
+			},
+			"required": []string{"path", "content"},
+		},
+		Handler: func(_ context.Context, argsJSON string) (string, error) {
+			var args struct {
+				Path      string `json:"path"`
+				Content   string `json:"content"`
+				Overwrite bool   `json:"overwrite"`
+				Append    bool   `json:"append"`
+			}
+			if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+				return "", fmt.Errorf("bad write_file args: %w", err)
+			}
+			return fileToolOutput(writeSandboxFile(root, args.Path, args.Content, args.Overwrite, args.Append))
+		},
+	}
+}
+
+// fileToolOutput sends problems with the path or the file back to the model as {"error": ...} so it can correct itself
+func fileToolOutput(result map[string]any, err error) (string, error) {
+	if err != nil {
+		result = map[string]any{"error": err.Error()}
+	}
+	out, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// sandboxPath turns the model's path into a clean relative one for os.Root, the root would refuse an escape anyway
+// but this gives the model a clear error instead of a syscall one
+func sandboxPath(p string) (string, error) {
+	p = filepath.ToSlash(strings.TrimSpace(p))
+	if p == "" {
+		return "", errors.New("path is required")
+	}
+	if path.IsAbs(p) || filepath.IsAbs(p) {
+		return "", fmt.Errorf("%s is absolute, use a path relative to the sandbox directory", p)
+	}
+	clean := path.Clean(p)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%s is outside the sandbox directory", p)
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+func readSandboxFile(root, p string) (map[string]any, error) {
+	rel, err := sandboxPath(p)
+	if err != nil {
+		return nil, err
+	}
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := r.Open(rel)
+	if err != nil {
+		return nil, sandboxError(p, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", p)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, fileReadMax+1))
+	if err != nil {
+		return nil, err
+	}
+	truncated := len(data) > fileReadMax
+	if truncated {
+		data = data[:fileReadMax]
+	}
+	probe := data
+	if truncated {
+		probe = data[:len(data)-utf8.UTFMax] //the cut may split the last character
+	}
+	if !utf8.Valid(probe) || bytes.IndexByte(data, 0) >= 0 {
+		return nil, fmt.Errorf("%s is not a text file", p)
+	}
+	return map[string]any{"path": p, "size": info.Size(), "content": strings.ToValidUTF8(string(data), ""), "truncated": truncated}, nil
+}
+
+func writeSandboxFile(root, p, content string, overwrite, appendTo bool) (map[string]any, error) {
+	rel, err := sandboxPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > fileWriteMax {
+		return nil, fmt.Errorf("the content is %d bytes, at most %d can be written at once", len(content), fileWriteMax)
+	}
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if dir := filepath.Dir(rel); dir != "." {
+		if err := r.MkdirAll(dir, 0o755); err != nil {
+			return nil, sandboxError(p, err)
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case appendTo:
+		flags |= os.O_APPEND
+	case overwrite:
+		flags |= os.O_TRUNC
+	default:
+		flags |= os.O_EXCL
+	}
+	f, err := r.OpenFile(rel, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%s already exists, set overwrite or append", p)
+	}
+	if err != nil {
+		return nil, sandboxError(p, err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return map[string]any{"path": p, "bytes_written": len(content)}, nil
+}
+
+// sandboxError hides the absolute sandbox path from the model and explains a symlink that leads out of the sandbox
+func sandboxError(p string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%s does not exist", p)
+	case strings.Contains(err.Error(), "escapes from parent"):
+		return fmt.Errorf("%s leads outside the sandbox directory", p)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%s: permission denied", p)
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Errorf("%s: %v", p, pathErr.Err)
+	}
+	return err
+}
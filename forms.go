@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// -------------------------- GUIDED FORMS (/form) --------------------------
+
+// "/form <name>" asks the questions of a template one by one and sends the answers as a single structured prompt,
+// so intake workflows like bug reports always give the model the same fields
+const (
+	formPrefix       = "/form"
+	formCancel       = "/cancel" //typed at any question, drops the form
+	formsFileEnvVar  = "REALTIME_CLI_FORMS"
+	maxFormQuestions = 50
+)
+
+// formQuestion is one question of a form. with choices the answer must be one of them (or its number)
+type formQuestion struct {
+	Field    string   `json:"field"`              //label of the answer in the prompt
+	Ask      string   `json:"ask"`                //what the user is asked
+	Choices  []string `json:"choices,omitempty"`  //a closed list of answers
+	Default  string   `json:"default,omitempty"`  //used for an empty answer
+	Optional bool     `json:"optional,omitempty"` //an empty answer is left out of the prompt
+}
+
+type formTemplate struct {
+	Description string         `json:"description,omitempty"`
+	Intro       string         `json:"intro"` //first line of the prompt, tells the model what to do with the answers
+	Questions   []formQuestion `json:"questions"`
+}
+
+// the bug report form is always there, a forms file can replace it or add more
+var defaultForms = map[string]formTemplate{
+	"bug-report": {
+		Description: "report a bug and get a triage summary",
+		Intro: "Here is a bug report. Summarize it, rate its severity and suggest what to check first. " +
+			"Ask for anything important that is missing.",
+		Questions: []formQuestion{
+			{Field: "Summary", Ask: "What went wrong, in one sentence?"},
+			{Field: "Steps to reproduce", Ask: "How can it be reproduced?"},
+			{Field: "Expected", Ask: "What did you expect to happen?"},
+			{Field: "Actual", Ask: "What happened instead?"},
+			{Field: "Frequency", Ask: "How often does it happen?", Choices: []string{"always", "sometimes", "once"}, Default: "always"},
+			{Field: "Environment", Ask: "Version, OS or browser (optional)", Optional: true},
+		},
+	},
+}
+
+// loadForms reads the templates of REALTIME_CLI_FORMS (a JSON object of name -> template) over the built-in ones
+func loadForms() (map[string]formTemplate, error) {
+	forms := map[string]formTemplate{}
+	for name, form := range defaultForms {
+		forms[name] = form
+	}
+	path := os.Getenv(formsFileEnvVar)
+	if path == "" {
+		return forms, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", formsFileEnvVar, err)
+	}
+	var loaded map[string]formTemplate
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", formsFileEnvVar, path, err)
+	}
+	for name, form := range loaded {
+		if err = form.validate(); err != nil {
+			return nil, fmt.Errorf("%s: form %q: %w", formsFileEnvVar, name, err)
+		}
+		forms[name] = form
+	}
+	return forms, nil
+}
+
+func (f formTemplate) validate() error {
+	if len(f.Questions) == 0 || len(f.Questions) > maxFormQuestions {
+		return fmt.Errorf("a form needs 1 to %d questions, got %d", maxFormQuestions, len(f.Questions))
+	}
+	for i, q := range f.Questions {
+		if q.Field == "" || q.Ask == "" {
+			return fmt.Errorf("question %d needs a field and an ask", i+1)
+		}
+		if q.Default != "" && len(q.Choices) > 0 && !slices.Contains(q.Choices, q.Default) {
+			return fmt.Errorf("question %q: the default %q is not one of the choices", q.Field, q.Default)
+		}
+	}
+	return nil
+}
+
+// listForms prints the usage of /form and the templates, sorted by name
+func listForms(forms map[string]formTemplate) {
+	names := make([]string, 0, len(forms))
+	for name := range forms {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	fmt.Println("Usage: /form <name>, the forms are:")
+	for _, name := range names {
+		if d := forms[name].Description; d != "" {
+			fmt.Printf("  %s - %s\n", name, d)
+		} else {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	fmt.Println()
+}
+
+var errFormCancelled = errors.New("form cancelled")
+
+// fill asks every question and returns the assembled prompt. errFormCancelled on /cancel, read errors
+// (end of input, the session time being up) are returned as is so the chat loop handles them
+func (f formTemplate) fill(lines *promptReader) (string, error) {
+	fmt.Printf("Answer %d questions, or type %s to stop.\n", len(f.Questions), formCancel)
+	var b strings.Builder
+	b.WriteString(f.Intro)
+	b.WriteString("\n")
+	for _, q := range f.Questions {
+		answer, err := q.ask(lines)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" { //optional and skipped
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s: %s", q.Field, answer)
+	}
+	return b.String(), nil
+}
+
+// ask repeats the question until the answer is valid
+func (q formQuestion) ask(lines *promptReader) (string, error) {
+	prompt := q.Ask
+	if q.Default != "" {
+		prompt += fmt.Sprintf(" [%s]", q.Default)
+	}
+	for i, choice := range q.Choices {
+		prompt += fmt.Sprintf("\n  %d) %s", i+1, choice)
+	}
+	prompt += "\n> "
+	for {
+		fmt.Print(prompt)
+		line, err := lines.readLine("> ")
+		line = strings.TrimSpace(line)
+		if line == "" && err != nil {
+			return "", err
+		}
+		switch {
+		case line == formCancel:
+			return "", errFormCancelled
+		case line == "" && q.Default != "":
+			return q.Default, nil
+		case line == "" && q.Optional:
+			return "", nil
+		case line == "":
+			fmt.Println("This question needs an answer.")
+		case len(q.Choices) == 0:
+			return line, nil
+		default:
+			if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(q.Choices) {
+				return q.Choices[n-1], nil
+			}
+			if i := slices.IndexFunc(q.Choices, func(c string) bool { return strings.EqualFold(c, line) }); i >= 0 {
+				return q.Choices[i], nil
+			}
+			fmt.Printf("Pick one of the %d options.\n", len(q.Choices))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------------- GATEWAY COMPATIBILITY --------------------------
+
+// self hosted realtime compatible gateways (LiteLLM, OpenRouter style proxies, internal ones) often mount the API on another
+// path, want the key in their own header and leave out events the client only uses as acknowledgements
+const (
+	gatewayPathEnvVar = "REALTIME_CLI_GATEWAY_PATH" //replaces the path of the endpoint url, e.g. /openai/v1/realtime
+	authHeaderEnvVar  = "REALTIME_CLI_AUTH_HEADER"  //e.g. api-key or x-litellm-api-key, the key is sent as is (no "Bearer")
+	gatewayEnvVar     = "REALTIME_CLI_GATEWAY"      //1 tolerates missing optional events
+	optionalEventWait = 2 * time.Second             //how long an optional event is waited for before it is assumed missing
+	defaultAuthHeader = "Authorization"
+)
+
+type gatewayOptions struct {
+	path       string
+	authHeader string
+	tolerant   bool
+
+	mu      sync.Mutex
+	missing map[string]bool //optional event types this server doesnt send, they are not waited for again
+}
+
+// gateway holds the defaults (the OpenAI API) until main loads the env vars
+var gateway = &gatewayOptions{authHeader: defaultAuthHeader}
+
+func loadGatewayOptions() (*gatewayOptions, error) {
+	g := &gatewayOptions{
+		path:       os.Getenv(gatewayPathEnvVar),
+		authHeader: os.Getenv(authHeaderEnvVar),
+		tolerant:   os.Getenv(gatewayEnvVar) == "1",
+		missing:    map[string]bool{},
+	}
+	if g.path != "" && !strings.HasPrefix(g.path, "/") {
+		return nil, fmt.Errorf("%s must start with /, got %q", gatewayPathEnvVar, g.path)
+	}
+	if g.authHeader == "" {
+		g.authHeader = defaultAuthHeader
+	}
+	return g, nil
+}
+
+// endpoint applies the gateway path to a realtime url, the query string is kept
+func (g *gatewayOptions) endpoint(raw string) (string, error) {
+	if g.path == "" {
+		return raw, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid realtime url %q: %w", raw, err)
+	}
+	u.Path = g.path
+	return u.String(), nil
+}
+
+// authValue is what goes into the auth header, only the standard Authorization header takes a bearer token
+func (g *gatewayOptions) authValue(apiKey string) string {
+	if strings.EqualFold(g.authHeader, defaultAuthHeader) {
+		return "Bearer " + apiKey
+	}
+	return apiKey
+}
+
+// waitForOptionalEvent is waitForEventTypeFromChan for acknowledgements the flow can do without (session.created,
+// conversation.item.created). in tolerant mode a missing one is waited for only briefly and then returns nil without an error,
+// and once a type went missing it is not waited for anymore
+func waitForOptionalEvent(ctx context.Context, eventsCh <-chan map[string]any, typ string) (map[string]any, error) {
+	g := gateway
+	if !g.tolerant {
+		return waitForEventTypeFromChan(ctx, eventsCh, typ)
+	}
+	g.mu.Lock()
+	missing := g.missing[typ]
+	g.mu.Unlock()
+	if missing {
+		return nil, nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, optionalEventWait)
+	defer cancel()
+	evt, err := waitForEventTypeFromChan(waitCtx, eventsCh, typ)
+	if err != nil && waitCtx.Err() != nil && ctx.Err() == nil {
+		slog.Warn("gateway: optional event not received, not waiting for it again", "type", typ)
+		g.mu.Lock()
+		g.missing[typ] = true
+		g.mu.Unlock()
+		return nil, nil
+	}
+	return evt, err
+}
@@ -2,6 +2,4 @@ module github.com/kerenschoss369/go-home-assignment
 
 go 1.25.0
 
-require (
-	nhooyr.io/websocket v1.8.17 // indirect
-)
+require nhooyr.io/websocket v1.8.17
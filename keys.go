@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// -------------------------- API KEYS (rotation + failover) --------------------------
+
+// teams that shard their spend across projects can give several keys, comma separated. with "failover" (the default) the
+// first key is used until it is rejected or out of quota, with "round-robin" every new connection takes the next key
+const (
+	apiKeysEnvVar   = "REALTIME_CLI_API_KEYS"
+	keyPolicyEnvVar = "REALTIME_CLI_KEY_POLICY"
+
+	keyPolicyFailover   = "failover"
+	keyPolicyRoundRobin = "round-robin"
+)
+
+// pooledKey is one key with its usage counters, only its label is ever printed or logged
+type pooledKey struct {
+	secret, label string
+	unusable      bool //rejected or out of quota, skipped until every key is
+
+	connections, turns, failures int
+}
+
+type apiKeyPool struct {
+	mu     sync.Mutex
+	keys   []*pooledKey
+	policy string
+	next   int //round-robin position
+}
+
+// loadAPIKeys reads REALTIME_CLI_API_KEYS, falling back to the single OPENAI_API_KEY
+func loadAPIKeys() (*apiKeyPool, error) {
+	policy := os.Getenv(keyPolicyEnvVar)
+	switch policy {
+	case "":
+		policy = keyPolicyFailover
+	case keyPolicyFailover, keyPolicyRoundRobin:
+	default:
+		return nil, fmt.Errorf("%s must be %q or %q, got %q", keyPolicyEnvVar, keyPolicyFailover, keyPolicyRoundRobin, policy)
+	}
+
+	p := &apiKeyPool{policy: policy}
+	for _, secret := range strings.Split(os.Getenv(apiKeysEnvVar), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			p.keys = append(p.keys, &pooledKey{secret: secret, label: keyLabel(len(p.keys)+1, secret)})
+		}
+	}
+	if len(p.keys) == 0 {
+		secret, err := loadAPIKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w (or set %s)", err, apiKeysEnvVar)
+		}
+		p.keys = []*pooledKey{{secret: secret, label: keyLabel(1, secret)}}
+	}
+	return p, nil
+}
+
+func keyLabel(n int, secret string) string {
+	if len(secret) < 8 {
+		return fmt.Sprintf("key %d", n)
+	}
+	return fmt.Sprintf("key %d (...%s)", n, secret[len(secret)-4:])
+}
+
+// pick returns the key for a new connection
+func (p *apiKeyPool) pick() *pooledKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	usable := 0
+	for _, k := range p.keys {
+		if !k.unusable {
+			usable++
+		}
+	}
+	if usable == 0 { //quotas refill and limits reset, give every key another chance rather than giving up
+		for _, k := range p.keys {
+			k.unusable = false
+		}
+	}
+
+	start := 0
+	if p.policy == keyPolicyRoundRobin {
+		start = p.next
+		p.next = (p.next + 1) % len(p.keys)
+	}
+	for i := range p.keys {
+		if k := p.keys[(start+i)%len(p.keys)]; !k.unusable {
+			return k
+		}
+	}
+	return p.keys[start]
+}
+
+// failover marks k unusable when err says the key itself is the problem and reports whether another key can be tried
+func (p *apiKeyPool) failover(k *pooledKey, err error) bool {
+	if !isKeyError(err) {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k.failures++
+	k.unusable = true
+	for _, other := range p.keys {
+		if !other.unusable {
+			slog.Warn("API key rejected, switching to the next one", "key", k.label, "next", other.label, "err", err)
+			return true
+		}
+	}
+	slog.Warn("API key rejected and no other key is left", "key", k.label, "err", err)
+	return false
+}
+
+func (p *apiKeyPool) recordConnection(k *pooledKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k.connections++
+}
+
+func (p *apiKeyPool) recordTurn(k *pooledKey) {
+	if k == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k.turns++
+}
+
+// summary reports the usage per key, it is empty with a single key since there is nothing to compare
+func (p *apiKeyPool) summary() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("API key usage:\n")
+	for _, k := range p.keys {
+		fmt.Fprintf(&b, "  %s: %d connections, %d turns, %d failures\n", k.label, k.connections, k.turns, k.failures)
+	}
+	return b.String()
+}
+
+// keyError marks errors caused by the key (invalid, no access, out of quota or rate limited), another key may work
+type keyError struct{ err error }
+
+func (e *keyError) Error() string { return e.err.Error() }
+func (e *keyError) Unwrap() error { return e.err }
+
+func isKeyError(err error) bool {
+	var ke *keyError
+	return errors.As(err, &ke)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+)
+
+// -------------------------- KIOSK MODE (-kiosk) --------------------------
+
+// for public demo terminals: no slash commands and no "exit", only the allowed tools, no previews, and the conversation
+// is cleared after -kiosk-idle without input so the next visitor starts fresh
+const kioskToolsEnvVar = "REALTIME_CLI_KIOSK_TOOLS"
+
+// tools that can't touch the machine or the network
+var defaultKioskTools = []string{"multiply", "add", "divide", "power", "sqrt", "evaluate"}
+
+func loadKioskTools() []string {
+	raw := os.Getenv(kioskToolsEnvVar)
+	if strings.TrimSpace(raw) == "" {
+		return defaultKioskTools
+	}
+	var allow []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allow = append(allow, name)
+		}
+	}
+	return allow
+}
+
+// only keeps the named tools, in the registry's order
+func (r *ToolRegistry) only(names []string) *ToolRegistry {
+	kept := NewToolRegistry()
+	for _, name := range names {
+		if _, ok := r.Lookup(name); !ok {
+			slog.Warn("kiosk: unknown tool in the allowlist", "tool", name, "env", kioskToolsEnvVar)
+		}
+	}
+	for _, name := range r.order {
+		if slices.Contains(names, name) {
+			kept.Register(r.byName[name]) //can't fail, the names come from a registry already
+		}
+	}
+	return kept
+}
+
+// kioskBlocked is true for input a visitor must not run: slash commands and exit
+func kioskBlocked(input string) bool {
+	return strings.HasPrefix(input, "/") || strings.EqualFold(input, "exit")
+}
+
+// holdKioskInterrupts keeps Ctrl+C from ending the chat. during a turn the session's own channel still gets it and the
+// response is cancelled, between turns it only lands here and is dropped
+func holdKioskInterrupts() {
+	dropped := make(chan os.Signal, 1)
+	signal.Notify(dropped, os.Interrupt)
+	go func() {
+		for range dropped {
+		}
+	}()
+}
+
+func kioskWelcome() {
+	fmt.Print("\033[H\033[2J") //clear the screen, the previous visitor's conversation is gone
+	fmt.Println("Welcome! Type your question and press Enter.")
+	fmt.Printf("The conversation is cleared after %s without input.\n\n", config.kioskIdle)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode"
+)
+
+// -------------------------- LANGUAGE DETECTION --------------------------
+
+// the language the session instructions are written in, answers in other languages are requested per response
+const (
+	defaultSessionLanguage = "English"
+	languageEnvVar         = "REALTIME_CLI_LANGUAGE"
+)
+
+func loadSessionLanguage() string {
+	if lang := os.Getenv(languageEnvVar); lang != "" {
+		return lang
+	}
+	return defaultSessionLanguage
+}
+
+// languages that can be told apart by their script alone
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hebrew, "Hebrew"},
+	{unicode.Arabic, "Arabic"},
+	{unicode.Cyrillic, "Russian"},
+	{unicode.Greek, "Greek"},
+	{unicode.Hiragana, "Japanese"},
+	{unicode.Katakana, "Japanese"},
+	{unicode.Hangul, "Korean"},
+	{unicode.Han, "Chinese"},
+	{unicode.Thai, "Thai"},
+	{unicode.Devanagari, "Hindi"},
+}
+
+// very common short words, enough to tell the main Latin script languages apart on a sentence or two
+var latinStopwords = map[string][]string{
+	"English":    {"the", "and", "is", "are", "what", "how", "you", "of", "to", "in", "it", "please", "can"},
+	"Spanish":    {"el", "la", "los", "las", "que", "es", "por", "qué", "cómo", "una", "para", "con", "y"},
+	"French":     {"le", "la", "les", "est", "et", "que", "des", "une", "pour", "avec", "vous", "je", "pas"},
+	"German":     {"der", "die", "das", "und", "ist", "nicht", "ich", "wie", "was", "ein", "eine", "mit", "zu"},
+	"Italian":    {"il", "lo", "gli", "che", "è", "di", "per", "una", "come", "sono", "non", "con", "cosa"},
+	"Portuguese": {"o", "os", "as", "que", "é", "não", "uma", "para", "com", "como", "você", "do", "da"},
+	"Dutch":      {"de", "het", "een", "en", "is", "niet", "ik", "wat", "hoe", "van", "je", "met", "zijn"},
+}
+
+// detectLanguage guesses the language of a user turn, it returns "" when the text is too short or ambiguous to tell
+func detectLanguage(text string) string {
+	// non latin scripts: the script that has the most letters wins
+	counts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, sl := range scriptLanguages {
+			if unicode.Is(sl.table, r) {
+				counts[sl.language]++
+				break
+			}
+		}
+	}
+	// japanese text is full of Han characters too, any kana at all means japanese
+	if counts["Japanese"] > 0 {
+		return "Japanese"
+	}
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount {
+			best, bestCount = lang, n
+		}
+	}
+	if letters > 0 && bestCount*2 >= letters {
+		return best
+	}
+
+	// latin script: count stopword hits, the guess needs a clear winner
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	if len(words) < 3 {
+		return ""
+	}
+	scores := map[string]int{}
+	for _, w := range words {
+		for lang, stopwords := range latinStopwords {
+			for _, sw := range stopwords {
+				if w == sw {
+					scores[lang]++
+				}
+			}
+		}
+	}
+	best, bestScore, second := "", 0, 0
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, second = lang, score, bestScore
+		case score > second:
+			second = score
+		}
+	}
+	if bestScore < 2 || bestScore == second {
+		return ""
+	}
+	return best
+}
+
+// instructionsForInput adds an explicit answer language to the instructions when the user wrote in another language than the session
+func instructionsForInput(instructions, sessionLanguage, input string) string {
+	lang := detectLanguage(input)
+	if lang == "" || strings.EqualFold(lang, sessionLanguage) {
+		return instructions
+	}
+	return instructions + " The user wrote in " + lang + ", answer in " + lang + "."
+}
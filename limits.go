@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// -------------------------- TOOL LIMITS --------------------------
+
+// guardrails on what the model can make the CLI do, 0 means unlimited. set with -max-tool-calls-per-response,
+// -max-tool-calls-per-session and -max-fetch-bytes, the config keys of the same names or the env vars
+const (
+	maxCallsPerResponseEnvVar = "REALTIME_CLI_MAX_TOOL_CALLS_PER_RESPONSE"
+	maxCallsPerSessionEnvVar  = "REALTIME_CLI_MAX_TOOL_CALLS_PER_SESSION"
+	maxFetchBytesEnvVar       = "REALTIME_CLI_MAX_FETCH_BYTES"
+
+	defaultMaxCallsPerResponse = 8
+	defaultMaxCallsPerSession  = 0
+	defaultMaxFetchBytes       = 10 << 20
+)
+
+type toolLimits struct {
+	perResponse, perSession int
+	fetchBytes              int64
+
+	mu           sync.Mutex
+	sessionCalls int
+	fetched      int64
+}
+
+// limits are the ones of the current conversation, every chat session counts its own (see SessionManager). nil until a
+// session is opened, a nil *toolLimits allows everything
+var limits *toolLimits
+
+func newToolLimits() *toolLimits {
+	return &toolLimits{perResponse: config.maxToolCallsPerResponse, perSession: config.maxToolCallsPerSession, fetchBytes: config.maxFetchBytes}
+}
+
+// parseLimit reads a limit of the config file or the environment, 0 is unlimited
+func parseLimit(name, value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a number >= 0 (0 is unlimited), got %q", name, value)
+	}
+	return n, nil
+}
+
+// admit counts a tool call, nth is its position in the response (starting at 0).
+// when a limit is hit the call must not run and the returned refusal is sent to the model instead
+func (l *toolLimits) admit(nth int) string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var reason string
+	switch {
+	case l.perResponse > 0 && nth >= l.perResponse:
+		reason = fmt.Sprintf("at most %d tool calls are allowed per response", l.perResponse)
+	case l.perSession > 0 && l.sessionCalls >= l.perSession:
+		reason = fmt.Sprintf("the limit of %d tool calls for this session was reached", l.perSession)
+	default:
+		l.sessionCalls++
+		return ""
+	}
+	fmt.Printf("Note: a tool call was refused, %s.\n", reason)
+	return errorOutput("tool call refused: " + reason + ", answer with what you have")
+}
+
+// reserveFetch is called by tools that download external data before they read n more bytes,
+// it returns an error once the session budget is used up
+func (l *toolLimits) reserveFetch(n int64) error {
+	if l == nil || l.fetchBytes == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fetched+n > l.fetchBytes {
+		fmt.Printf("Note: the session fetch budget of %d bytes is used up.\n", l.fetchBytes)
+		return fmt.Errorf("the session fetch budget of %d bytes is used up", l.fetchBytes)
+	}
+	l.fetched += n
+	return nil
+}
+
+// refundFetch gives back the part of a reservation that was not read, a short page costs what it is and not a whole chunk
+func (l *toolLimits) refundFetch(n int64) {
+	if l == nil || l.fetchBytes == 0 || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fetched = max(0, l.fetched-n)
+}
+
+// errorOutput is a function_call_output that tells the model why the call gave no result
+func errorOutput(reason string) string {
+	out, _ := json.Marshal(map[string]string{"error": reason})
+	return string(out)
+}
@@ -0,0 +1,470 @@
+// Package localrealtime serves the OpenAI Realtime API (beta event names, text only) on top of a local model, so the CLI can
+// run fully offline. Every response is a streamed request to an OpenAI compatible chat completions endpoint, which Ollama
+// (http://127.0.0.1:11434/v1), llama.cpp, LM Studio and vLLM all provide. The conversation, the instructions and the function
+// tools of the realtime session are kept here and sent with every request, tool calls of the model come back as
+// function_call items and their function_call_output items are answered as tool messages, like the realtime API does.
+package localrealtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"nhooyr.io/websocket"
+)
+
+// Options selects the local backend.
+type Options struct {
+	BaseURL string // chat completions base url, e.g. http://127.0.0.1:11434/v1 for Ollama
+	Model   string // local model name, empty takes the model query parameter the client dials with
+	APIKey  string // sent as a bearer token when set, local servers usually don't need one
+}
+
+// Handler upgrades every request to a websocket and runs one session on it, backed by the local model.
+func Handler(opts Options) http.Handler {
+	var sessions atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		model := opts.Model
+		if model == "" {
+			model = r.URL.Query().Get("model")
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.SetReadLimit(16 << 20)
+		s := &session{conn: c, opts: opts, model: model, id: fmt.Sprintf("sess_local_%d", sessions.Add(1))}
+		err = s.run(r.Context())
+		if websocket.CloseStatus(err) == -1 && err != nil {
+			slog.Warn("localrealtime: session ended", "session", s.id, "err", err)
+		}
+	})
+}
+
+// chatMessage is a message of the chat completions API
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type toolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// entry is a conversation item and the chat message it stands for, the id is kept for conversation.item.delete
+type entry struct {
+	id  string
+	msg chatMessage
+}
+
+type session struct {
+	conn  *websocket.Conn
+	opts  Options
+	model string
+	id    string
+
+	mu           sync.Mutex
+	instructions string
+	tools        []any //function tools in the chat completions shape
+	history      []entry
+	items        int
+	responses    int
+	cancel       context.CancelFunc //of the response in progress, nil when there is none
+}
+
+func (s *session) run(ctx context.Context) error {
+	defer s.conn.CloseNow()
+	ctx, stop := context.WithCancel(ctx)
+	defer stop() //ends a response still streaming from the backend
+
+	// text only and with a tools list, so the client turns off the speaker and keeps function calling on
+	created := map[string]any{"id": s.id, "object": "realtime.session", "model": s.model, "modalities": []string{"text"}, "tools": []any{}}
+	if err := s.send(ctx, map[string]any{"type": "session.created", "session": created}); err != nil {
+		return err
+	}
+	for {
+		_, data, err := s.conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+		var evt map[string]any
+		if err := json.Unmarshal(data, &evt); err != nil {
+			if err := s.sendError(ctx, "invalid_request_error", "invalid JSON: "+err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.handle(ctx, evt); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *session) handle(ctx context.Context, evt map[string]any) error {
+	switch typ, _ := evt["type"].(string); typ {
+	case "session.update":
+		session, _ := evt["session"].(map[string]any)
+		if session == nil {
+			return s.sendError(ctx, "invalid_request_error", "missing session")
+		}
+		s.updateSession(session)
+		session["modalities"] = []string{"text"}
+		return s.send(ctx, map[string]any{"type": "session.updated", "session": session})
+
+	case "conversation.item.create":
+		item, _ := evt["item"].(map[string]any)
+		if item == nil {
+			return s.sendError(ctx, "invalid_request_error", "missing item")
+		}
+		if err := s.addItem(item); err != nil {
+			return s.sendError(ctx, "invalid_request_error", err.Error())
+		}
+		return s.send(ctx, map[string]any{"type": "conversation.item.created", "item": item})
+
+	case "conversation.item.delete":
+		id, _ := evt["item_id"].(string)
+		s.mu.Lock()
+		n := len(s.history)
+		s.history = slices.DeleteFunc(s.history, func(e entry) bool { return e.id == id })
+		deleted := len(s.history) < n
+		s.mu.Unlock()
+		if !deleted {
+			return s.sendError(ctx, "item_not_found", fmt.Sprintf("there is no item %q", id))
+		}
+		return s.send(ctx, map[string]any{"type": "conversation.item.deleted", "item_id": id})
+
+	case "response.create":
+		response, _ := evt["response"].(map[string]any)
+		instructions, _ := response["instructions"].(string)
+		return s.startResponse(ctx, instructions)
+
+	case "response.cancel":
+		s.mu.Lock()
+		cancel := s.cancel
+		s.mu.Unlock()
+		if cancel == nil {
+			return s.sendError(ctx, "response_cancel_not_active", "there is no active response to cancel")
+		}
+		cancel()
+		return nil
+
+	case "input_audio_buffer.commit":
+		return s.sendError(ctx, "invalid_request_error", "the local backend is text only, audio input is not supported")
+
+	default:
+		return nil //other events (audio chunks, truncation) have nothing to do with a text model and are accepted silently
+	}
+}
+
+func (s *session) updateSession(session map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if instructions, ok := session["instructions"].(string); ok {
+		s.instructions = instructions
+	}
+	if tools, ok := session["tools"].([]any); ok {
+		s.tools = nil
+		for _, t := range tools {
+			tool, _ := t.(map[string]any)
+			if tool["type"] != "function" {
+				continue
+			}
+			s.tools = append(s.tools, map[string]any{"type": "function", "function": map[string]any{
+				"name": tool["name"], "description": tool["description"], "parameters": tool["parameters"],
+			}})
+		}
+	}
+}
+
+// addItem turns a realtime conversation item into a chat message, an item without an id gets one like on the real API
+func (s *session) addItem(item map[string]any) error {
+	var msg chatMessage
+	switch item["type"] {
+	case "message":
+		role, _ := item["role"].(string)
+		msg = chatMessage{Role: role, Content: messageText(item)}
+	case "function_call_output":
+		callID, _ := item["call_id"].(string)
+		output, _ := item["output"].(string)
+		msg = chatMessage{Role: "tool", Content: output, ToolCallID: callID}
+	case "function_call": //a call from an earlier conversation put back into this one
+		call := toolCall{Type: "function"}
+		call.ID, _ = item["call_id"].(string)
+		call.Function.Name, _ = item["name"].(string)
+		call.Function.Arguments, _ = item["arguments"].(string)
+		msg = chatMessage{Role: "assistant", ToolCalls: []toolCall{call}}
+	default:
+		return fmt.Errorf("unsupported item type %v", item["type"])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items++
+	if _, ok := item["id"]; !ok {
+		item["id"] = fmt.Sprintf("item_%d", s.items)
+	}
+	id, _ := item["id"].(string)
+	s.history = append(s.history, entry{id: id, msg: msg})
+	return nil
+}
+
+// startResponse streams the response in the background, so response.cancel can still be read while the model is generating
+func (s *session) startResponse(ctx context.Context, instructions string) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return s.sendError(ctx, "conversation_already_has_active_response", "a response is already in progress")
+	}
+	respCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.responses++
+	rid := fmt.Sprintf("resp_%d", s.responses)
+	if instructions == "" {
+		instructions = s.instructions
+	}
+	var messages []chatMessage
+	if instructions != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: instructions})
+	}
+	for _, e := range s.history {
+		messages = append(messages, e.msg)
+	}
+	request := map[string]any{"model": s.model, "messages": messages, "stream": true, "stream_options": map[string]any{"include_usage": true}}
+	if len(s.tools) > 0 {
+		request["tools"] = s.tools
+	}
+	s.mu.Unlock()
+
+	go func() {
+		done, err := s.respond(ctx, respCtx, rid, request)
+		cancel()
+		s.mu.Lock()
+		s.cancel = nil //before response.done goes out, the client may answer it with the next response.create right away
+		s.mu.Unlock()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("localrealtime: response failed", "session", s.id, "response", rid, "err", err)
+				s.sendError(ctx, "local_backend_error", err.Error())
+			}
+			return
+		}
+		s.send(ctx, done)
+	}()
+	return nil
+}
+
+// streamChunk is one server-sent event of a streamed chat completion
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// respond runs one chat completion and forwards it as realtime events up to the response.done, which it returns.
+// a cancelled response is done too, an error means there is no response.done and the client gets an error event instead
+func (s *session) respond(ctx, respCtx context.Context, rid string, request map[string]any) (map[string]any, error) {
+	if err := s.send(ctx, map[string]any{"type": "response.created", "response": map[string]any{"id": rid, "status": "in_progress"}}); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(respCtx, http.MethodPost, strings.TrimRight(s.opts.BaseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opts.APIKey)
+	}
+
+	var text strings.Builder
+	var calls []toolCall
+	var inputTokens, outputTokens int
+	msgID := rid + "_msg"
+	status := "completed"
+
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+			return nil, fmt.Errorf("%s answered %s: %s", s.opts.BaseURL, resp.Status, strings.TrimSpace(string(detail)))
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64<<10), 4<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue //blank separators and comments
+			}
+			if data = strings.TrimSpace(data); data == "[DONE]" {
+				break
+			}
+			var chunk streamChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return nil, fmt.Errorf("bad stream chunk from the local backend: %w", err)
+			}
+			if chunk.Usage != nil {
+				inputTokens, outputTokens = chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens
+			}
+			for _, choice := range chunk.Choices {
+				if d := choice.Delta.Content; d != "" {
+					if text.Len() == 0 {
+						if err := s.send(ctx, map[string]any{"type": "response.output_item.added", "response_id": rid, "item": map[string]any{"id": msgID, "type": "message", "role": "assistant"}}); err != nil {
+							return nil, err
+						}
+					}
+					text.WriteString(d)
+					if err := s.send(ctx, map[string]any{"type": "response.text.delta", "response_id": rid, "item_id": msgID, "output_index": 0, "content_index": 0, "delta": d}); err != nil {
+						return nil, err
+					}
+				}
+				for _, tc := range choice.Delta.ToolCalls { //the id and name come with the first delta of a call, the arguments in pieces
+					for len(calls) <= tc.Index {
+						calls = append(calls, toolCall{Type: "function"})
+					}
+					call := &calls[tc.Index]
+					if tc.ID != "" {
+						call.ID = tc.ID
+					}
+					if tc.Function.Name != "" {
+						call.Function.Name = tc.Function.Name
+					}
+					call.Function.Arguments += tc.Function.Arguments
+				}
+			}
+		}
+		err = scanner.Err()
+	}
+	switch {
+	case respCtx.Err() != nil && ctx.Err() == nil: //response.cancel, what was generated so far stays in the conversation
+		status, calls = "cancelled", nil
+	case err != nil:
+		return nil, fmt.Errorf("local backend at %s: %w", s.opts.BaseURL, err)
+	}
+
+	if text.Len() > 0 {
+		if err := s.send(ctx, map[string]any{"type": "response.text.done", "response_id": rid, "item_id": msgID, "text": text.String()}); err != nil {
+			return nil, err
+		}
+		if err := s.send(ctx, map[string]any{"type": "response.output_item.done", "response_id": rid, "item": map[string]any{"id": msgID, "type": "message", "role": "assistant"}}); err != nil {
+			return nil, err
+		}
+	}
+	for i := range calls {
+		call := &calls[i]
+		if call.ID == "" {
+			call.ID = fmt.Sprintf("call_%s_%d", rid, i)
+		}
+		item := map[string]any{"id": fmt.Sprintf("%s_call_%d", rid, i), "type": "function_call", "name": call.Function.Name, "call_id": call.ID}
+		events := []map[string]any{
+			{"type": "response.output_item.added", "response_id": rid, "item": item},
+			{"type": "response.function_call_arguments.delta", "response_id": rid, "item_id": item["id"], "call_id": call.ID, "delta": call.Function.Arguments},
+			{"type": "response.output_item.done", "response_id": rid, "item": withField(item, "arguments", call.Function.Arguments)},
+		}
+		for _, e := range events {
+			if err := s.send(ctx, e); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if text.Len() > 0 || len(calls) > 0 {
+		s.mu.Lock()
+		s.history = append(s.history, entry{id: msgID, msg: chatMessage{Role: "assistant", Content: text.String(), ToolCalls: calls}})
+		s.mu.Unlock()
+	}
+	usage := map[string]any{
+		"total_tokens": inputTokens + outputTokens, "input_tokens": inputTokens, "output_tokens": outputTokens,
+		"input_token_details":  map[string]any{"text_tokens": inputTokens, "audio_tokens": 0, "cached_tokens": 0},
+		"output_token_details": map[string]any{"text_tokens": outputTokens, "audio_tokens": 0},
+	}
+	return map[string]any{"type": "response.done", "response": map[string]any{"id": rid, "status": status, "usage": usage}}, nil
+}
+
+func (s *session) send(ctx context.Context, evt map[string]any) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return s.conn.Write(ctx, websocket.MessageText, data) //safe from the response goroutine too, writes are serialized by the conn
+}
+
+func (s *session) sendError(ctx context.Context, code, message string) error {
+	return s.send(ctx, map[string]any{"type": "error", "error": map[string]any{"type": "invalid_request_error", "code": code, "message": message}})
+}
+
+// messageText joins the text parts of a message item (input_text, text and output_text alike)
+func messageText(item map[string]any) string {
+	parts, _ := item["content"].([]any)
+	var texts []string
+	for _, p := range parts {
+		part, _ := p.(map[string]any)
+		if text, ok := part["text"].(string); ok {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+func withField(m map[string]any, key string, value any) map[string]any {
+	out := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
+
+// Check asks the backend for its models, so a server that is not running is reported at startup and not on the first turn.
+func Check(ctx context.Context, opts Options) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(opts.BaseURL, "/")+"/models", nil)
+	if err != nil {
+		return err
+	}
+	if opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s/models answered %s", opts.BaseURL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/localrealtime"
+)
+
+// -------------------------- LOCAL MODEL SERVER (subcommand) --------------------------
+
+// runLocalServer serves the realtime API on top of a local model (Ollama or any OpenAI compatible chat completions server),
+// the chat runs against it like against the mock server, with no API key and nothing leaving the machine
+func runLocalServer(args []string) error {
+	fs := flag.NewFlagSet("local-server", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8091", "address to listen on")
+	backend := fs.String("backend", "http://127.0.0.1:11434/v1", "chat completions base url of the local server (the default is Ollama)")
+	model := fs.String("model", "", "local model, e.g. llama3.1 (default: the model the CLI asks for, REALTIME_CLI_MODEL)")
+	fs.Parse(args)
+
+	opts := localrealtime.Options{BaseURL: *backend, Model: *model, APIKey: os.Getenv("REALTIME_CLI_LOCAL_API_KEY")}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := localrealtime.Check(ctx, opts); err != nil {
+		return fmt.Errorf("local backend not reachable (is Ollama running?): %w", err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Local realtime API listening, point the CLI at it with: REALTIME_CLI_URL=ws://%s/v1/realtime REALTIME_CLI_MODEL=<local model> OPENAI_API_KEY=local\n", ln.Addr())
+	srv := &http.Server{Handler: localrealtime.Handler(opts), ReadHeaderTimeout: 5 * time.Second}
+	return srv.Serve(ln)
+}
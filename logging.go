@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// -------------------------- LOGGING --------------------------
+
+// diagnostics go through slog to stderr (or a file), the chat itself keeps printing to stdout.
+// the env vars set the defaults for every mode, the chat flags -log-level/-log-json/-log-file override them.
+// the default level is warn, the info logs (every tool call, every reconnect) would land in the middle of the chat
+const (
+	logLevelEnvVar = "REALTIME_CLI_LOG_LEVEL"
+	logJSONEnvVar  = "REALTIME_CLI_LOG_JSON"
+	logFileEnvVar  = "REALTIME_CLI_LOG_FILE"
+)
+
+type logOptions struct {
+	level string //debug, info, warn or error
+	json  bool
+	file  string //empty means stderr
+}
+
+func loadLogOptions() logOptions {
+	opts := logOptions{level: "warn", json: os.Getenv(logJSONEnvVar) == "1", file: os.Getenv(logFileEnvVar)}
+	if v := os.Getenv(logLevelEnvVar); v != "" {
+		opts.level = v
+	}
+	return opts
+}
+
+// setupLogging installs the default slog logger, the standard log package goes through it too.
+// called once per run, when the options are final: the -log-file it opens stays open until the process ends
+func setupLogging(opts logOptions) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(opts.level))); err != nil {
+		return fmt.Errorf("log level must be debug, info, warn or error, got %q", opts.level)
+	}
+
+	var w io.Writer = os.Stderr
+	if opts.file != "" {
+		f, err := os.OpenFile(opts.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		w = f //left open for the life of the process
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(w, handlerOpts)
+	if opts.json {
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -5,13 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/kerenschoss369/go-home-assignment/events"
 	"nhooyr.io/websocket"
 )
 
@@ -20,6 +25,10 @@ const (
 	modelName            = "gpt-4o-mini-realtime-preview"
 	defaultInstructions  = "Provide a detailed response."
 	multipleInstractions = "When the user asks to multiply two numbers call the multiply tool."
+
+	// the websocket library only accepts 32KiB frames by default, big response.done events and audio deltas are larger than that
+	defaultReadLimit = 16 << 20
+	readLimitEnvVar  = "REALTIME_CLI_READ_LIMIT"
 )
 
 // -------------------------- initializition --------------------------
@@ -32,110 +41,137 @@ func loadAPIKey() (string, error) {
 	return apiKey, nil
 }
 
+// loadReadLimit returns the max size in bytes of a single inbound message
+func loadReadLimit() (int64, error) {
+	raw := os.Getenv(readLimitEnvVar)
+	if raw == "" {
+		return defaultReadLimit, nil
+	}
+	limit, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of bytes, got %q", readLimitEnvVar, raw)
+	}
+	return limit, nil
+}
+
 // -------------------------- DIAL --------------------------
 
-func dialRealtime(ctx context.Context, apiKey, model string) (*websocket.Conn, error) {
-	url := fmt.Sprint(realtimeURL, "?model=", model)
-	header := http.Header{
-		"Authorization": []string{"Bearer " + apiKey},
-		"OpenAI-Beta":   []string{"realtime=v1"},
+func dialRealtime(ctx context.Context, apiKey, model string, readLimit int64) (*realtimeConn, error) {
+	return dialRealtimeURL(ctx, apiKey, fmt.Sprint(config.url, "?model=", model), requestedProtocol, readLimit)
+}
+
+func dialRealtimeURL(ctx context.Context, apiKey, url, protocol string, readLimit int64) (*realtimeConn, error) {
+	url, err := gateway.endpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	header := config.headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if config.userAgent != "" {
+		header.Set("User-Agent", config.userAgent)
+	}
+	header.Set(gateway.authHeader, gateway.authValue(apiKey))
+	if protocol == protocolBeta {
+		header.Set("OpenAI-Beta", "realtime=v1") //without this header the server speaks the GA protocol
 	}
 
+	slog.Debug("dialing", "url", url, "protocol", protocol)
 	conn, resp, err := websocket.Dial(ctx, url, &websocket.DialOptions{HTTPHeader: header})
 	if err != nil {
-		if resp != nil {
-			return nil, fmt.Errorf("websocket handshake failed: %s: %w", resp.Status, err)
-		}
-		return nil, err
+		return nil, describeHandshakeError(resp, err)
 	}
-	return conn, nil
+	slog.Debug("connected", "url", url)
+	conn.SetReadLimit(readLimit)
+	return &realtimeConn{Conn: conn, protocol: protocol}, nil
 }
 
 // -------------------------- WRITE --------------------------
 
-// this function adds a new conversation item to the time line (but it doesnt mean that the model will start generating a response yet)
-func sendUserInput(ctx context.Context, c *websocket.Conn, textInput string) error {
-	conversationItemObj := map[string]any{
-		"type": "conversation.item.create", //for realtime conversation
-		"item": map[string]any{
-			"type": "message",
-			"role": "user",
-			"content": []map[string]any{
-				{
-					"type": "input_text",
-					"text": textInput,
-				},
-			},
-		},
-	}
-	return marshalAndSend(ctx, c, conversationItemObj)
+// this function adds the user input to the time line (but it doesnt mean that the model will start generating a response yet).
+// very long inputs are split into several conversation items, the number of items sent is returned
+func sendUserInput(ctx context.Context, c *realtimeConn, textInput string) (int, error) {
+	chunks := splitUserText(textInput, maxUserTextChunkBytes)
+	if len(chunks) > 1 {
+		fmt.Printf("Note: your input is %d bytes, sending it as %d parts.\n", len(textInput), len(chunks))
+	}
+	for i, chunk := range chunks {
+		conversationItemObj, err := events.NewConversationItemCreate(events.UserText(chunk))
+		if err != nil {
+			return i, err
+		}
+		if err = marshalAndSend(ctx, c, conversationItemObj); err != nil {
+			return i, err
+		}
+	}
+	return len(chunks), nil
 }
 
 // this function will ask to actually generate a response (using the instructions too)
-func requestTextResponse(ctx context.Context, c *websocket.Conn, instructions string) error {
-	responseRequestObj := map[string]any{
-		"type": "response.create",
-		"response": map[string]any{
-			"modalities":   []string{"text"}, //make sure the response will be in a text format
-			"instructions": instructions,
-		},
+func requestTextResponse(ctx context.Context, c *realtimeConn, instructions string) error {
+	response := events.Response{
+		Modalities:   speaker.modalities(), //text only, unless the answers are also spoken
+		Instructions: instructions,
+	}
+	sampling.apply(&response) //what /set changed
+	responseRequestObj, err := events.NewResponseCreate(response)
+	if err != nil {
+		return err
 	}
 	return marshalAndSend(ctx, c, responseRequestObj)
 }
 
 // -------------------------- TOOL --------------------------
-func addMultipleToTools(ctx context.Context, c *websocket.Conn) error {
-	body := map[string]any{
-		"type": "session.update",
-		"session": map[string]any{
-			"instructions": defaultInstructions + multipleInstractions,
-			"tools": []map[string]any{
-				{
-					"type":        "function",
-					"name":        "multiply",
-					"description": "Multiply two numbers and return the result.",
-					"parameters": map[string]any{
-						"type": "object",
-						"properties": map[string]any{
-							"a": map[string]any{"type": "number"},
-							"b": map[string]any{"type": "number"},
-						},
-						"required": []string{"a", "b"},
-					},
-				},
-			},
-		},
+func registerTools(ctx context.Context, c *realtimeConn, tools *ToolRegistry) error {
+	body, err := events.NewSessionConfig().
+		Instructions(config.instructions + tools.Instructions()). //only the tools this session announces are mentioned
+		Tools(tools.Definitions()...).
+		Build()
+	if err != nil {
+		return err
 	}
 	return marshalAndSend(ctx, c, body)
 }
 
-func sendFunctionOutput(ctx context.Context, c *websocket.Conn, callID string, outputJSON string) error {
-	msg := map[string]any{
-		"type": "conversation.item.create",
-		"item": map[string]any{
-			"type":    "function_call_output",
-			"call_id": callID,
-			"output":  outputJSON,
-		},
+func sendFunctionOutput(ctx context.Context, c *realtimeConn, callID string, outputJSON string) error {
+	msg, err := events.NewConversationItemCreate(events.FunctionCallOutput(callID, outputJSON))
+	if err != nil {
+		return err
 	}
 	return marshalAndSend(ctx, c, msg)
 }
 
-func marshalAndSend(ctx context.Context, c *websocket.Conn, data any) error {
+func marshalAndSend(ctx context.Context, c *realtimeConn, data any) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("marshal error: %w", err) //conversion error
 	}
-	err = c.Write(ctx, websocket.MessageText, jsonData)
-	if err != nil {
-		return fmt.Errorf("write error: %w", err) //error to write it to the web socket
+	if c == nil { //a replay has no connection, there is nothing to answer
+		return nil
+	}
+	jsonData = adaptOutbound(jsonData, c.protocol)
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		var evt struct{ Type string }
+		json.Unmarshal(jsonData, &evt)
+		slog.Debug("event sent", "type", evt.Type, "bytes", len(jsonData))
+	}
+	if err = checkOutboundSize(jsonData); err != nil {
+		return err
+	}
+	for _, frame := range chaos.frames("outbound", jsonData) {
+		recorder.record("out", frame)
+		err = writeWithRetry(ctx, c, frame)
+		if err != nil {
+			return fmt.Errorf("write error: %w", err) //error to write it to the web socket
+		}
 	}
 	return nil
 }
 
 // -------------------------- READ and utilities --------------------------
 
-func startReader(ctx context.Context, c *websocket.Conn) (eventsCh <-chan map[string]any, errsCh <-chan error) {
+func startReader(ctx context.Context, c *realtimeConn) (eventsCh <-chan map[string]any, errsCh <-chan error) {
 	events := make(chan map[string]any, 128)
 	errs := make(chan error, 128)
 
@@ -153,128 +189,312 @@ func startReader(ctx context.Context, c *websocket.Conn) (eventsCh <-chan map[st
 
 			_, data, err := c.Read(ctx)
 			if err != nil {
-				errs <- err
+				errs <- describeCloseError(err)
 				return
 			}
 
-			var evt map[string]any
-			err = json.Unmarshal(data, &evt)
-			if err != nil {
-				errs <- fmt.Errorf("reader json unmarshal failed: %w", err)
-				continue
+			for _, frame := range chaos.frames("inbound", data) {
+				recorder.record("in", frame)
+				var evt map[string]any
+				err = json.Unmarshal(frame, &evt)
+				if err != nil {
+					errs <- fmt.Errorf("reader json unmarshal failed: %w", err)
+					continue
+				}
+				evt = normalizeInbound(evt)
+				slog.Debug("event received", "type", evt["type"], "bytes", len(frame))
+				events <- evt
 			}
-			events <- evt
 		}
 	}()
 
 	return events, errs
 }
 
-func waitForEventTypeFromChan(ctx context.Context, events <-chan map[string]any, expectedEventType string) error {
+func waitForEventTypeFromChan(ctx context.Context, events <-chan map[string]any, expectedEventType string) (map[string]any, error) {
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for %s: %w", expectedEventType, ctx.Err())
+			return nil, fmt.Errorf("timeout waiting for %s: %w", expectedEventType, ctx.Err())
 		case evt, ok := <-events:
 			if !ok {
-				return fmt.Errorf("events channel closed while waiting for %s", expectedEventType)
+				return nil, fmt.Errorf("events channel closed while waiting for %s", expectedEventType)
 			}
 			typ, _ := evt["type"].(string)
 			if typ == "error" {
-				b, _ := json.Marshal(evt)
-				return fmt.Errorf("server error: %s", string(b))
+				return nil, describeServerError(evt)
 			}
 			if typ == expectedEventType {
-				return nil
+				return evt, nil
 			}
 		}
 	}
 }
 
-func streamAssistantTextFromChan(ctx context.Context, c *websocket.Conn, events <-chan map[string]any) (string, bool, error) {
-	var full string
-	needFollowUp, printedWithNoTool := false, false
-
-	argBuf := map[string]*strings.Builder{}
+// streamAssistantTextFromChan streams exactly one response to sink: it waits for the response.created of the response we asked for,
+// ignores events that belong to any other response id, and returns only when that same response is done
+// the function calls of the response are returned too, the caller runs them and opens a follow-up response
+// Ctrl+C sends response.cancel, the rest of the response is dropped and errResponseCancelled is returned once it is done
+// reaching a -stop string cancels the response the same way, but the text up to the stop string is returned as the answer
+func streamAssistantTextFromChan(ctx context.Context, c *realtimeConn, eventsCh <-chan map[string]any, interrupts <-chan os.Signal, sink OutputSink) (string, []functionCall, error) {
+	var full, responseID string
+	var calls []functionCall
+	cancelled, stopped := false, false
+	stops := newStopMatcher(config.stops)
+	scan := extractors.newScan()
+
+	items := map[string]*outputItem{}
+	open := false //a message was started on the sink and not ended yet
+	show := func(text string) {
+		overlay.publish(overlayEvent{Type: "delta", Text: text})
+		if !cancelled { //the rest of a cancelled response is dropped
+			sink.Delta(text)
+		}
+	}
+	endMessage := func() {
+		if open && !cancelled {
+			sink.EndMessage()
+		}
+		open = false
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return full, needFollowUp, fmt.Errorf("stream timeout: %w", ctx.Err())
+			return full, calls, fmt.Errorf("stream timeout: %w", ctx.Err())
 
-		case evt, ok := <-events:
+		case <-interrupts:
+			if cancelled {
+				continue
+			}
+			cancelled = true
+			sink.Cancelled()
+			speaker.flush()
+			if err := marshalAndSend(ctx, c, events.NewResponseCancel()); err != nil {
+				return full, nil, err
+			}
+
+		case evt, ok := <-eventsCh:
 			if !ok {
-				return full, needFollowUp, fmt.Errorf("events channel closed during stream")
+				return full, calls, fmt.Errorf("events channel closed during stream")
 			}
 
 			typ, _ := evt["type"].(string)
 			if typ == "error" {
-				b, _ := json.Marshal(evt)
-				return full, needFollowUp, fmt.Errorf("server error: %s", string(b))
+				errObj, _ := evt["error"].(map[string]any)
+				if code, _ := errObj["code"].(string); (cancelled || stopped) && code == "response_cancel_not_active" {
+					continue //the response ended before the cancel arrived, its response.done is still on the way
+				}
+				return full, calls, describeServerError(evt)
+			}
+
+			if typ == "response.created" {
+				if responseID == "" {
+					responseID = responseIDOf(evt)
+				}
+				continue
+			}
+			if responseID == "" && gateway.tolerant && strings.HasPrefix(typ, "response.") { //a gateway that doesnt forward response.created
+				responseID = responseIDOf(evt)
+			}
+			// anything from a response we are not streaming (a late response.done of the previous one etc.) is dropped
+			if strings.HasPrefix(typ, "response.") && (responseID == "" || responseIDOf(evt) != responseID) {
+				continue
 			}
 
 			switch typ {
-			case "response.text.delta": //not a tool just a normal response
-				if d, ok := evt["delta"].(string); ok {
-					if !printedWithNoTool {
-						fmt.Print("Chatbot> ")
-						printedWithNoTool = true
+			case "response.output_item.added": //a response can hold several items (text messages and function calls), each is rendered on its own
+				item, _ := evt["item"].(map[string]any)
+				it := itemOf(items, item)
+				if it != nil {
+					it.name, _ = item["name"].(string)
+					it.callID, _ = item["call_id"].(string)
+				}
+
+			case "response.audio.delta": //spoken answers only, the text of the same item comes as audio_transcript deltas
+				delta, _ := evt["delta"].(string)
+				speaker.play(delta)
+				overlay.audioLevel(delta)
+				if !cancelled && !stopped { //what comes after a cancel is never heard
+					podcast.audio(delta)
+				}
+
+			case "response.text.delta", "response.audio_transcript.delta": //not a tool just a normal response
+				if d, ok := evt["delta"].(string); ok && !stopped {
+					it := itemOf(items, map[string]any{"id": evt["item_id"], "type": "message"})
+					if !it.printed {
+						if full != "" {
+							full += "\n"
+						}
+						endMessage()
+						if !cancelled {
+							sink.StartMessage()
+						}
+						it.printed, open = true, true
 					}
-					fmt.Print(d)
+					d, hit := stops.feed(d)
+					show(d)
 					full += d
+					scan.feed(d)
+					if hit { //the rest of the response is not wanted, the message still ends with its newline below
+						stopped = true
+						speaker.flush()
+						if err := marshalAndSend(ctx, c, events.NewResponseCancel()); err != nil {
+							return full, nil, err
+						}
+					}
 				}
 
-			case "response.function_call_arguments.delta": //tool response that need to be saved in argBuf for later
-				callID, _ := evt["call_id"].(string)
+			case "response.function_call_arguments.delta": //tool response that need to be buffered in its item for later
 				delta, _ := evt["delta"].(string)
-				if callID == "" || delta == "" {
+				it := itemOf(items, map[string]any{"id": evt["item_id"], "type": "function_call"})
+				if it == nil || delta == "" {
 					continue
 				}
-				buf := argBuf[callID]
-				if buf == nil {
-					buf = &strings.Builder{}
-					argBuf[callID] = buf
+				it.args.WriteString(delta)
+
+			case "response.output_item.done":
+				item, _ := evt["item"].(map[string]any)
+				it := itemOf(items, item)
+				if it == nil {
+					continue
 				}
-				buf.WriteString(delta)
-
-			case "response.function_call_arguments.done": //tool response done now we need to send the argBuf
-				callID, _ := evt["call_id"].(string)
-				argsJSON, _ := evt["arguments"].(string)
-				if argsJSON == "" {
-					if b := argBuf[callID]; b != nil {
-						argsJSON = b.String()
+				switch it.typ {
+				case "message":
+					if rest := stops.flush(); rest != "" && !stopped {
+						show(rest)
+						full += rest
+						scan.feed(rest)
+					}
+					scan.flush()
+					if it.printed {
+						endMessage()
+					}
+				case "function_call": //the done item carries the final name/call_id/arguments, the buffered deltas are only a fallback
+					if name, ok := item["name"].(string); ok && name != "" {
+						it.name = name
+					}
+					if callID, ok := item["call_id"].(string); ok && callID != "" {
+						it.callID = callID
+					}
+					argsJSON, _ := item["arguments"].(string)
+					if argsJSON == "" {
+						argsJSON = it.args.String()
 					}
+					calls = append(calls, functionCall{name: it.name, callID: it.callID, args: argsJSON})
 				}
-
-				var args struct {
-					A float64 `json:"a"`
-					B float64 `json:"b"`
+				delete(items, it.id)
+
+			case "response.done": //text.done only closes one content part, the response itself may still have more output
+				usage.record(evt)
+				if rest := stops.flush(); rest != "" && !stopped { //a gateway that leaves out output_item.done
+					show(rest)
+					full += rest
+					scan.feed(rest)
 				}
-
-				err := json.Unmarshal([]byte(argsJSON), &args)
-				if err != nil {
-					return full, needFollowUp, fmt.Errorf("bad function args: %w", err)
+				scan.flush()
+				endMessage()
+				overlay.publish(overlayEvent{Type: "done"})
+				podcast.answer(full)
+				if (cancelled || stopped) && cancelCrossed(evt) {
+					dropCancelError(ctx, eventsCh)
 				}
-
-				result := multiply(args.A, args.B)
-				out := fmt.Sprintf(`{"result": %g}`, result)
-				err = sendFunctionOutput(ctx, c, callID, out)
-				if err != nil {
-					return full, needFollowUp, err
+				if cancelled {
+					return full, nil, errResponseCancelled
+				}
+				if stopped {
+					return full, nil, nil //calls of a cut response are not run
 				}
+				return full, calls, nil
+			}
+		}
+	}
+}
 
-				delete(argBuf, callID)
-				needFollowUp = true //tells the caller to open a new response after this one ends
+// outputItem is the state of a single item inside a response
+type outputItem struct {
+	id, typ      string
+	name, callID string //function_call items only
+	args         strings.Builder
+	printed      bool //message items only, whether the "Chatbot> " prefix was already written
+}
 
-			case "response.text.done", "response.done":
-				if printedWithNoTool {
-					fmt.Println()
-				}
+// itemOf returns the tracked item for the given item object (creating it on first sight), or nil if it has no id
+func itemOf(items map[string]*outputItem, item map[string]any) *outputItem {
+	id, _ := item["id"].(string)
+	if id == "" {
+		return nil
+	}
+	it := items[id]
+	if it == nil {
+		typ, _ := item["type"].(string)
+		it = &outputItem{id: id, typ: typ}
+		items[id] = it
+	}
+	return it
+}
+
+// functionCall is a finished function_call item, it runs only after its response is done
+type functionCall struct {
+	name, callID, args string
+}
 
-				return full, needFollowUp, nil
+// runFunctionCalls executes the function calls of one response and sends every result back as a function_call_output item.
+// the limits and the previews are applied one call at a time (a preview reads the terminal), then the approved calls run
+// concurrently on at most config.toolConcurrency workers, and the outputs are sent in the order the model made the calls
+func runFunctionCalls(c *realtimeConn, tools *ToolRegistry, calls []functionCall) ([]toolUse, error) {
+	used := make([]toolUse, len(calls))
+	approved := make([]bool, len(calls))
+	for i, call := range calls {
+		used[i] = toolUse{Name: call.name, Args: call.args, Output: limits.admit(i)}
+		if used[i].Output == "" {
+			used[i].Args, approved[i] = previewToolCall(call.name, call.args)
+			used[i].Output = rejectedToolOutput
+		}
+	}
+
+	workers := make(chan struct{}, config.toolConcurrency)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if !approved[i] {
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer func() { <-workers; wg.Done() }()
+			started := time.Now()
+			out, err := tools.runTool(call.name, used[i].Args) //a failed call still has an output, the model is told what went wrong
+			if err != nil {
+				slog.Warn("tool call failed", "tool", call.name, "call_id", call.callID, "duration", time.Since(started).Round(time.Millisecond), "err", err)
+			} else {
+				slog.Info("tool call", "tool", call.name, "call_id", call.callID, "duration", time.Since(started).Round(time.Millisecond), "output_bytes", len(out))
 			}
+			stats.recordToolCall(call.name)
+			used[i].Output = out
+		}()
+	}
+	wg.Wait()
+
+	for i, call := range calls {
+		sendCtx, cancelSend := opContext("send tool output", 10*time.Second)
+		err := sendFunctionOutput(sendCtx, c, call.callID, used[i].Output)
+		cancelSend()
+		if err != nil {
+			return used[:i], err
 		}
 	}
+	return used, nil
+}
+
+// responseIDOf returns the response id an event belongs to (response.created/done carry it inside the response object)
+func responseIDOf(evt map[string]any) string {
+	if resp, ok := evt["response"].(map[string]any); ok {
+		id, _ := resp["id"].(string)
+		return id
+	}
+	id, _ := evt["response_id"].(string)
+	return id
 }
 
 // -------------------------- helpers --------------------------
@@ -282,107 +502,277 @@ func multiply(a, b float64) float64 { return a * b }
 
 // -------------------------- main --------------------------
 func main() {
-	apiKey, err := loadAPIKey()
+	config.log = loadLogOptions() //installed once the flags are parsed, until then the errors go to stderr as they are
+	stats = loadTelemetry()
+	colors = loadColors()
+	chaos = loadChaos()
+	if err := loadConfigFile(configPath()); err != nil {
+		fatalf("config: %v", err)
+	}
+	if err := loadConfigEnv(); err != nil {
+		fatalf("config: %v", err)
+	}
+	g, err := loadGatewayOptions()
 	if err != nil {
-		log.Fatal(err)
+		fatalf("config: %v", err)
+	}
+	gateway = g
+
+	// subcommands, anything else starts the interactive chat
+	if len(os.Args) > 1 {
+		subcommands := map[string]func([]string) error{
+			"transcribe":   runTranscribe,
+			"notes":        runNotes,
+			"dictate":      runDictate,
+			"mock-server":  runMockServer,
+			"local-server": runLocalServer,
+			"merge":        runMerge,
+			"diff":         runDiff,
+			"serve":        runServe,
+		}
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := setupLogging(config.log); err != nil {
+				fatalf("%v", err)
+			}
+			stats.recordFeature("subcommand:" + os.Args[1])
+			if err := run(os.Args[2:]); err != nil {
+				fatalf("%s: %v", os.Args[1], err)
+			}
+			stats.flush()
+			return
+		}
+	}
+	if err := parseChatFlags(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fatalf("%v", err)
+	}
+	if err := setupLogging(config.log); err != nil {
+		fatalf("%v", err)
+	}
+	if config.replay != "" {
+		if err := runReplay(config.replay); err != nil {
+			fatalf("replay: %v", err)
+		}
+		return
 	}
 
-	dialCtx, cancelDial := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancelDial()
-	conn, err := dialRealtime(dialCtx, apiKey, modelName)
+	keys, err := loadAPIKeys()
 	if err != nil {
-		log.Fatalf("dial failed: %v", err)
+		fatalf("%v", err)
 	}
-	defer conn.Close(websocket.StatusNormalClosure, "")
-
-	// start a single reader goroutine for the whole session
-	sessionCtx, cancelSession := context.WithCancel(context.Background())
-	defer cancelSession()
-	eventsCh, errsCh := startReader(sessionCtx, conn)
+	requestedProtocol, err = loadProtocol()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	readLimit, err := loadReadLimit()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	sessionLanguage := loadSessionLanguage()
+	containerMode := loadContainerMode()
+	if config.noColor || containerMode {
+		colors.enabled = false
+	}
+	renderMarkdown = !config.plain && !containerMode && colors.enabled
+	var turnLog *jsonLines
+	if containerMode {
+		turnLog = redirectForContainer()
+		startHealthServer()
+	}
+	if err = applyRegion(keys.pick().secret, readLimit); err != nil {
+		fatalf("%v", err)
+	}
+	usage = newUsageTracker(config.model)
+	speaker, err = loadSpeaker()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	forms, err := loadForms()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	extractors, err = newExtractorSet(config.extractors, config.extractOut)
+	if err != nil {
+		fatalf("extract: %v", err)
+	}
+	if config.overlay != "" {
+		if overlay, err = startOverlay(config.overlay); err != nil {
+			fatalf("overlay: %v", err)
+		}
+	}
+	defer func() { speaker.close() }() //the speaker is dropped when the model has no audio
+	recorder, err = openRecorder(config.record)
+	if err != nil {
+		fatalf("record: %v", err)
+	}
+	defer recorder.close()
 
-	// register the multiple function tool
-	updCtx, cancelUpd := context.WithTimeout(context.Background(), 10*time.Second)
-	if err = addMultipleToTools(updCtx, conn); err != nil {
-		cancelUpd()
-		log.Fatalf("failed to register tools: %v", err)
+	sessions := NewSessionManager(keys, config.model, readLimit)
+	if _, err = sessions.open(); err != nil {
+		fatalf("%v", err)
+	}
+	defer sessions.closeAll()
+	sessionReady.Store(true)
+	if speaker != nil && !sessions.current.sess.Capabilities().Audio {
+		fmt.Println("Note: this model does not support spoken answers, they stay text only.")
+		speaker.close()
+		speaker = nil
+	}
+	if config.podcast != "" {
+		if speaker == nil {
+			slog.Warn("podcast: the answers are not spoken, nothing is recorded (set the env var to 1)", "env", audioOutputEnvVar)
+		} else if podcast, err = openPodcast(config.podcast); err != nil {
+			fatalf("podcast: %v", err)
+		}
 	}
-	cancelUpd()
+	defer func() {
+		if err := podcast.close(); err != nil {
+			slog.Warn("podcast: saving the recording failed", "file", config.podcast, "err", err)
+		}
+	}()
 
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Welcome to Real-time GPT-4o-mini CLI with Function Calling!")
-	fmt.Println("Type your prompt and press Enter to generate a response or type 'exit' to leave.\n")
-
+	switch {
+	case containerMode: //there is nobody to answer a preview in a container
+	case config.kiosk: //nor should a visitor of a kiosk decide what runs
+		holdKioskInterrupts()
+		kioskWelcome()
+	default:
+		previewInput = loadToolPreview(reader)
+		fmt.Println("Welcome to Real-time GPT-4o-mini CLI with Function Calling!")
+		fmt.Print("Type your prompt and press Enter to generate a response or type 'exit' to leave.\n\n")
+	}
+	fmt.Print(stats.notice())
+	stats.recordChatModes()
+
+	clock := newSessionClock(config.maxSession, config.sessionWarn)
+	lines := &promptReader{r: reader, clock: clock}
+	commands := chatCommands()
+	chat := &chatContext{sessions: sessions, lines: lines, forms: forms, commands: commands}
+	prompt := "You> "
+	if containerMode {
+		prompt = ""
+	}
 	for {
-		// get the input from the user (and exit the program if he ask for it)
-		fmt.Print("You> ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			log.Fatalf("failed to read the input: %v", err)
+		cur := sessions.current
+
+		// get the input from the user (and exit the program if he ask for it, or when -max-session is up)
+		input, err := "", errSessionOver
+		if !clock.over() { //a turn can run past the end, then the wrap-up comes right after it
+			if config.kiosk && len(cur.transcript.Entries) > 0 { //an empty conversation has nothing to clear
+				lines.idle = config.kioskIdle
+			}
+			startTyping, endTyping := colors.typing()
+			fmt.Print(colors.user(prompt) + startTyping)
+			input, err = lines.readLine(prompt)
+			fmt.Print(endTyping)
+			lines.idle = 0
+		}
+		if errors.Is(err, errIdle) {
+			if err = sessions.reset(); err != nil {
+				fatalf("%v", err)
+			}
+			kioskWelcome()
+			continue
+		}
+		if errors.Is(err, errSessionOver) {
+			if err = wrapUp(cur, config.wrapUpFile, clock); err != nil {
+				fmt.Println(colors.errorText(fmt.Sprintf("Could not write the wrap-up summary: %v", err)))
+			}
+			fmt.Print(usage.summary())
+			fmt.Print(keys.summary())
+			stats.flush()
+			return
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			fatalf("failed to read the input: %v", err)
 		}
 		input = strings.TrimSpace(input)
-		if strings.EqualFold(input, "exit") {
-			fmt.Println("Thanks for using my system, see you next time!")
+		if input == "" && err != nil && config.kiosk && isTerminal(os.Stdin) { //Ctrl+D only clears the visitor's conversation, the terminal reads on
+			if len(cur.transcript.Entries) > 0 {
+				if err = sessions.reset(); err != nil {
+					fatalf("%v", err)
+				}
+				kioskWelcome()
+			} else {
+				fmt.Println()
+			}
+			continue
+		}
+		if input == "" && err != nil { //end of input (a closed pipe or Ctrl+D), a last line without a newline was already handled
+			fmt.Println()
+			fmt.Print(usage.summary())
+			fmt.Print(keys.summary())
+			stats.flush()
 			return
 		}
-
-		// send the user input to create a new conversation item
-		sendCtx, cancelSend := context.WithTimeout(context.Background(), 30*time.Second)
-		if err = sendUserInput(sendCtx, conn, input); err != nil {
-			cancelSend()
-			log.Fatalf("failed to send user input: %v", err)
+		if config.kiosk && kioskBlocked(input) {
+			fmt.Print("Commands are turned off on this terminal, just type your question.\n\n")
+			continue
 		}
-		cancelSend()
-
-		// make sure that the conversation item was created
-		waitCtx, cancelWait := context.WithTimeout(context.Background(), 30*time.Second)
-		if err = waitForEventTypeFromChan(waitCtx, eventsCh, "conversation.item.created"); err != nil {
-			cancelWait()
-			log.Fatal(err)
+		if strings.EqualFold(input, "exit") {
+			input = exitCommand
 		}
-		cancelWait()
 
-		// generate the response
-		reqCtx, cancelReq := context.WithTimeout(context.Background(), 30*time.Second)
-		if err = requestTextResponse(reqCtx, conn, defaultInstructions); err != nil {
-			cancelReq()
-			log.Fatal(err)
+		// slash commands, the ones that ask the model something (/revise, /escalate, /form) return the turn to run
+		turn := chatTurn{input: input, typed: input, out: newTerminalSink(os.Stdout)}
+		if strings.HasPrefix(input, "//") { //the transcript, the overlay and the podcast show what the model was asked too
+			turn.input, turn.typed = input[1:], input[1:]
 		}
-		cancelReq()
-
-		// stream the response
-		streamCtx, cancelStream := context.WithTimeout(context.Background(), 30*time.Second)
-		_, needFollowUp, err := streamAssistantTextFromChan(streamCtx, conn, eventsCh)
+		handled, cmdTurn, err := commands.dispatch(chat, input)
 		if err != nil {
-			cancelStream()
-			log.Fatal(err)
+			fatalf("%v", err)
 		}
-		cancelStream()
-
-		if needFollowUp {
-			toolResReqCtx, cancelToolResReq := context.WithTimeout(context.Background(), 30*time.Second)
-			if err = requestTextResponse(toolResReqCtx, conn, defaultInstructions); err != nil {
-				cancelToolResReq()
-				log.Fatal(err)
-			}
-			cancelToolResReq()
-
-			toolResStreamCtx, cancelToolResStream := context.WithTimeout(context.Background(), 30*time.Second)
-			_, _, err = streamAssistantTextFromChan(toolResStreamCtx, conn, eventsCh)
-			if err != nil {
-				cancelToolResStream()
-				log.Fatal(err)
-			}
-			cancelToolResStream()
+		if chat.quit {
+			fmt.Println("Thanks for using my system, see you next time!")
+			fmt.Print(usage.summary())
+			fmt.Print(keys.summary())
+			stats.flush()
+			return
+		}
+		if handled && cmdTurn == nil {
+			continue
+		}
+		if cmdTurn != nil {
+			turn = *cmdTurn
+		}
+		stats.recordTurn()
+		overlay.publish(overlayEvent{Type: "user", Text: turn.typed})
+		podcast.question(turn.typed)
+
+		// generate the response (in the language the user wrote in)
+		instructions := instructionsForInput(config.instructions, sessionLanguage, turn.input)
+		asked := time.Now()
+		cur.sess.catchInterrupts() //Ctrl+C cancels the response instead of quitting
+		answer, used, err := runValidatedTurn(cur, turn.input, instructions, turn.out, turn.escalate)
+		cur.sess.releaseInterrupts()
+		cancelled := errors.Is(err, errResponseCancelled)
+		if err != nil && !cancelled {
+			fatalf("%v", err)
+		}
+		switch {
+		case turn.revising && cancelled: //the revision itself is not shown, only what changed
+			fmt.Println("(cancelled)")
+		case turn.revising:
+			fmt.Println("Chatbot (changes)> " + wordDiff(cur.lastAnswer, answer))
+		}
+		if config.toolFooter && len(used) > 0 {
+			fmt.Println(colors.tool(toolFooter(used)))
+		}
+		if !cancelled {
+			cur.lastInput, cur.lastAnswer = turn.input, answer
+		}
+		cur.transcript.addTurn(asked, turn.typed, answer, used)
+		if turnLog != nil {
+			turnLog.write(cur.transcript.Entries[len(cur.transcript.Entries)-2:]...)
 		}
 		fmt.Println()
 
 		// takes care of any reader errors to continue to the iteration if there is no errors
-		select {
-		case err = <-errsCh:
-			if err != nil {
-				log.Fatalf("reader error: %v", err)
-			}
-		default:
+		if err = cur.sess.checkReader(); err != nil {
+			fatalf("%v", err)
 		}
 	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// -------------------------- MARKDOWN RENDERING (-plain turns it off) --------------------------
+
+// the answers are rendered a line at a time: a line is only known to be a heading, a list item or a code fence
+// once it is complete, so the text of a line shows up when its newline arrives instead of delta by delta
+const (
+	ansiBold      = "\033[1m"
+	ansiItalic    = "\033[3m"
+	ansiUnderline = "\033[4m"
+	ansiDim       = "\033[2m"
+	ansiBlue      = "\033[34m"
+	ansiCyan      = "\033[36m"
+)
+
+var renderMarkdown bool //set in main: a terminal, without -plain and outside container mode
+
+// isTerminal reports whether f is a character device, so piped or redirected output stays plain text
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdQuote    = regexp.MustCompile(`^>\s?(.*)$`)
+	mdRule     = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	mdCode     = regexp.MustCompile("`([^`]+)`")
+	mdBold     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic   = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*)\*`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	codeString = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	codeWord   = regexp.MustCompile(`\b[A-Za-z_]\w*\b`)
+)
+
+// keywords of the usual languages of an answer, highlighting is a hint and not a parser
+var codeKeywords = []string{
+	"break", "case", "class", "const", "continue", "def", "default", "defer", "elif", "else", "except", "export", "false",
+	"False", "finally", "fn", "for", "from", "func", "function", "go", "if", "import", "in", "interface", "lambda", "let",
+	"map", "match", "nil", "None", "null", "package", "pass", "pub", "raise", "range", "return", "select", "self", "struct",
+	"switch", "this", "throw", "true", "True", "try", "type", "var", "while", "with", "yield",
+}
+
+// languages whose comments start with #, the others use //
+var hashCommentLanguages = []string{"python", "py", "sh", "bash", "shell", "zsh", "ruby", "rb", "yaml", "yml", "toml", "r", "perl"}
+
+// markdownRenderer renders the streamed text of one answer, write takes the deltas and flush the rest of the last line
+type markdownRenderer struct {
+	out    io.Writer
+	line   strings.Builder
+	inCode bool
+	lang   string
+}
+
+func newMarkdownRenderer(out io.Writer) *markdownRenderer {
+	return &markdownRenderer{out: out}
+}
+
+func (m *markdownRenderer) write(delta string) {
+	for {
+		before, after, found := strings.Cut(delta, "\n")
+		m.line.WriteString(before)
+		if !found {
+			return
+		}
+		fmt.Fprintln(m.out, m.renderLine(m.line.String()))
+		m.line.Reset()
+		delta = after
+	}
+}
+
+// flush writes a line the message ended without a newline, the next message starts outside of a code block.
+// a nil renderer has nothing to flush
+func (m *markdownRenderer) flush() {
+	if m == nil {
+		return
+	}
+	if m.line.Len() > 0 {
+		fmt.Fprint(m.out, m.renderLine(m.line.String()))
+		m.line.Reset()
+	}
+	m.inCode = false
+}
+
+func (m *markdownRenderer) renderLine(line string) string {
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") {
+		m.inCode = !m.inCode
+		m.lang = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))
+		if m.inCode && m.lang != "" {
+			return ansiDim + "── " + m.lang + " " + strings.Repeat("─", 20) + ansiReset
+		}
+		return ansiDim + strings.Repeat("─", 24) + ansiReset
+	}
+	if m.inCode {
+		return "  " + highlightCode(line, m.lang)
+	}
+	if mdRule.MatchString(line) {
+		return ansiDim + strings.Repeat("─", 40) + ansiReset
+	}
+	if g := mdHeading.FindStringSubmatch(line); g != nil {
+		return ansiBold + ansiUnderline + renderInline(g[2]) + ansiReset
+	}
+	if g := mdBullet.FindStringSubmatch(line); g != nil {
+		return g[1] + "  • " + renderInline(g[2])
+	}
+	if g := mdQuote.FindStringSubmatch(line); g != nil {
+		return ansiDim + "│ " + renderInline(g[1]) + ansiReset
+	}
+	return renderInline(line)
+}
+
+// renderInline formats code spans, links, bold and italic. code spans are cut out first so nothing inside them is formatted
+func renderInline(text string) string {
+	var spans []string
+	text = mdCode.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, ansiCyan+s[1:len(s)-1]+ansiReset)
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	text = mdLink.ReplaceAllString(text, ansiUnderline+"${1}"+ansiReset+ansiDim+" (${2})"+ansiReset) //before the escape codes add brackets of their own
+	text = mdBold.ReplaceAllString(text, ansiBold+"${1}${2}"+ansiReset)
+	text = mdItalic.ReplaceAllString(text, "${1}"+ansiItalic+"${2}"+ansiReset)
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return text
+}
+
+// highlightCode colors the comment, the strings and the keywords of a code line
+func highlightCode(line, lang string) string {
+	marker := "//"
+	if slices.Contains(hashCommentLanguages, lang) {
+		marker = "#"
+	}
+	code, comment := line, ""
+	if i := commentStart(line, marker); i >= 0 {
+		code, comment = line[:i], ansiDim+line[i:]+ansiReset
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range codeString.FindAllStringIndex(code, -1) {
+		b.WriteString(highlightWords(code[last:loc[0]]))
+		b.WriteString(ansiGreen + code[loc[0]:loc[1]] + ansiReset)
+		last = loc[1]
+	}
+	b.WriteString(highlightWords(code[last:]))
+	return b.String() + comment
+}
+
+func highlightWords(code string) string {
+	return codeWord.ReplaceAllStringFunc(code, func(w string) string {
+		if slices.Contains(codeKeywords, w) {
+			return ansiBlue + w + ansiReset
+		}
+		return w
+	})
+}
+
+// commentStart finds the comment marker outside of string literals, -1 when the line has no comment
+func commentStart(line, marker string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && strings.HasPrefix(line[i:], marker):
+			return i
+		}
+	}
+	return -1
+}
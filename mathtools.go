@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -------------------------- math TOOLS (add, divide, power, sqrt, evaluate) --------------------------
+
+const (
+	mathInstructions = " For other arithmetic use the add, divide, power and sqrt tools, or evaluate for a whole expression, instead of calculating yourself."
+	maxExpressionLen = 1000 //longer expressions are refused, nobody types them and they only cost recursion
+)
+
+// twoNumbers is the schema of the tools that take a and b
+func twoNumbers(a, b string) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"a": map[string]any{"type": "number", "description": a},
+			"b": map[string]any{"type": "number", "description": b},
+		},
+		"required": []string{"a", "b"},
+	}
+}
+
+// binaryMathTool builds a tool of two numbers, math problems (like dividing by zero) go back to the model as {"error": ...}
+func binaryMathTool(name, description string, schema map[string]any, op func(a, b float64) (float64, error)) Tool {
+	return Tool{
+		Name:        name,
+		Description: description,
+		JSONSchema:  schema,
+		Handler: func(_ context.Context, argsJSON string) (string, error) {
+			var args struct {
+				A *float64 `json:"a"`
+				B *float64 `json:"b"`
+			}
+			if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+				return "", fmt.Errorf("bad function args: %w", err)
+			}
+			if args.A == nil || args.B == nil {
+				return mathOutput(0, errors.New("both a and b are required"))
+			}
+			return mathOutput(op(*args.A, *args.B))
+		},
+	}
+}
+
+var addTool = binaryMathTool("add", "Add two numbers and return the sum.", twoNumbers("first addend", "second addend"),
+	func(a, b float64) (float64, error) { return a + b, nil })
+
+var divideTool = binaryMathTool("divide", "Divide a by b and return the quotient.", twoNumbers("dividend", "divisor"),
+	func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	})
+
+var powerTool = binaryMathTool("power", "Raise a to the power of b.", twoNumbers("base", "exponent"),
+	func(a, b float64) (float64, error) { return math.Pow(a, b), nil })
+
+var sqrtTool = Tool{
+	Name:        "sqrt",
+	Description: "Return the square root of a non-negative number.",
+	JSONSchema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"x": map[string]any{"type": "number"}},
+		"required":   []string{"x"},
+	},
+	Handler: func(_ context.Context, argsJSON string) (string, error) {
+		var args struct {
+			X *float64 `json:"x"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("bad function args: %w", err)
+		}
+		switch {
+		case args.X == nil:
+			return mathOutput(0, errors.New("x is required"))
+		case *args.X < 0:
+			return mathOutput(0, fmt.Errorf("the square root of %g is not a real number", *args.X))
+		}
+		return mathOutput(math.Sqrt(*args.X), nil)
+	},
+}
+
+var evaluateTool = Tool{
+	Name: "evaluate",
+	Description: "Evaluate an arithmetic expression like (2+3)*4^2/sqrt(16). Supports + - * / % ^, parentheses, " +
+		"the constants pi and e and the functions sqrt, abs, ln, log (base 10), exp, sin, cos, tan (radians), floor, ceil and round.",
+	JSONSchema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"expression": map[string]any{"type": "string"}},
+		"required":   []string{"expression"},
+	},
+	Handler: func(_ context.Context, argsJSON string) (string, error) {
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("bad function args: %w", err)
+		}
+		return mathOutput(evaluateExpression(args.Expression))
+	},
+}
+
+// mathOutput is the JSON output of every math tool, results that are not a finite number are reported as errors
+func mathOutput(v float64, err error) (string, error) {
+	if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		err = errors.New("the result is not a finite number")
+	}
+	if err != nil {
+		out, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(out), nil
+	}
+	return fmt.Sprintf(`{"result": %g}`, v), nil
+}
+
+// -------------------------- expression evaluator --------------------------
+
+// evaluateExpression parses and computes the expression with the usual precedence: ^ (right associative) binds tighter than
+// unary minus, which binds tighter than * / %, then + -
+func evaluateExpression(expr string) (float64, error) {
+	if strings.TrimSpace(expr) == "" {
+		return 0, errors.New("the expression is empty")
+	}
+	if len(expr) > maxExpressionLen {
+		return 0, fmt.Errorf("the expression is longer than %d characters", maxExpressionLen)
+	}
+	p := &exprParser{src: expr}
+	v, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	if p.skipSpaces(); p.pos < len(p.src) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos+1)
+	}
+	return v, nil
+}
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+var exprFunctions = map[string]func(float64) float64{
+	"sqrt": math.Sqrt, "abs": math.Abs, "ln": math.Log, "log": math.Log10, "exp": math.Exp,
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan, "floor": math.Floor, "ceil": math.Ceil, "round": math.Round,
+}
+
+var exprConstants = map[string]float64{"pi": math.Pi, "e": math.E}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// accept consumes c when it is the next character
+func (p *exprParser) accept(c byte) bool {
+	if p.skipSpaces(); p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) sum() (float64, error) {
+	v, err := p.product()
+	for err == nil {
+		switch {
+		case p.accept('+'):
+			var r float64
+			r, err = p.product()
+			v += r
+		case p.accept('-'):
+			var r float64
+			r, err = p.product()
+			v -= r
+		default:
+			return v, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *exprParser) product() (float64, error) {
+	v, err := p.unary()
+	for err == nil {
+		var op byte
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		case p.accept('%'):
+			op = '%'
+		default:
+			return v, nil
+		}
+		var r float64
+		if r, err = p.unary(); err != nil {
+			break
+		}
+		switch {
+		case op == '*':
+			v *= r
+		case r == 0:
+			err = errors.New("division by zero")
+		case op == '/':
+			v /= r
+		default:
+			v = math.Mod(v, r)
+		}
+	}
+	return 0, err
+}
+
+func (p *exprParser) unary() (float64, error) {
+	if p.accept('-') {
+		v, err := p.unary()
+		return -v, err
+	}
+	p.accept('+')
+	return p.power()
+}
+
+func (p *exprParser) power() (float64, error) {
+	base, err := p.operand()
+	if err != nil || !p.accept('^') {
+		return base, err
+	}
+	exp, err := p.unary() //right associative, and 2^-1 is allowed
+	return math.Pow(base, exp), err
+}
+
+func (p *exprParser) operand() (float64, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0, errors.New("the expression ends too early")
+	}
+	if p.accept('(') {
+		v, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		return v, nil
+	}
+
+	start := p.pos
+	if c := rune(p.src[p.pos]); unicode.IsLetter(c) {
+		for p.pos < len(p.src) && unicode.IsLetter(rune(p.src[p.pos])) {
+			p.pos++
+		}
+		name := strings.ToLower(p.src[start:p.pos])
+		if v, ok := exprConstants[name]; ok {
+			return v, nil
+		}
+		fn, ok := exprFunctions[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown name %q", name)
+		}
+		if !p.accept('(') {
+			return 0, fmt.Errorf("%s needs its argument in parentheses", name)
+		}
+		arg, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing ) after the argument of %s", name)
+		}
+		return fn(arg), nil
+	}
+
+	p.digits(true)
+	if p.pos > start && p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') { //exponent like 1.5e3
+		mantissaEnd := p.pos
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		exponentStart := p.pos
+		if p.digits(false); p.pos == exponentStart {
+			p.pos = mantissaEnd //not an exponent after all, the "e" is left for the error message
+		}
+	}
+	if p.pos == start {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos+1)
+	}
+	v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", p.src[start:p.pos])
+	}
+	return v, nil
+}
+
+// digits consumes a run of digits (and dots when allowed)
+func (p *exprParser) digits(dots bool) {
+	for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || dots && p.src[p.pos] == '.') {
+		p.pos++
+	}
+}
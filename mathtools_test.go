@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMathTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    Tool
+		args    string
+		want    string //the whole output
+		wantErr bool   //the arguments are not JSON, the call itself fails
+	}{
+		{"add", addTool, `{"a": 2, "b": 3.5}`, `{"result": 5.5}`, false},
+		{"add zero is given", addTool, `{"a": 0, "b": 0}`, `{"result": 0}`, false},
+		{"add missing b", addTool, `{"a": 2}`, `{"error":"both a and b are required"}`, false},
+		{"add string number", addTool, `{"a": "2", "b": 3}`, ``, true},
+		{"add not json", addTool, `{"a": 2,`, ``, true},
+		{"divide", divideTool, `{"a": 7, "b": 2}`, `{"result": 3.5}`, false},
+		{"divide by zero", divideTool, `{"a": 1, "b": 0}`, `{"error":"division by zero"}`, false},
+		{"divide missing both", divideTool, `{}`, `{"error":"both a and b are required"}`, false},
+		{"power", powerTool, `{"a": 2, "b": 10}`, `{"result": 1024}`, false},
+		{"power overflow", powerTool, `{"a": 10, "b": 400}`, `{"error":"the result is not a finite number"}`, false},
+		{"sqrt", sqrtTool, `{"x": 16}`, `{"result": 4}`, false},
+		{"sqrt negative", sqrtTool, `{"x": -4}`, `{"error":"the square root of -4 is not a real number"}`, false},
+		{"sqrt missing x", sqrtTool, `{"y": 4}`, `{"error":"x is required"}`, false},
+		{"sqrt not json", sqrtTool, `x=4`, ``, true},
+		{"evaluate", evaluateTool, `{"expression": "(2+3)*4^2/sqrt(16)"}`, `{"result": 20}`, false},
+		{"evaluate empty", evaluateTool, `{}`, `{"error":"the expression is empty"}`, false},
+		{"evaluate bad syntax", evaluateTool, `{"expression": "2+"}`, `{"error":"the expression ends too early"}`, false},
+		{"evaluate not json", evaluateTool, `[1]`, ``, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.tool.Handler(context.Background(), tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got %s", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.want {
+				t.Errorf("got %s, want %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"24 / 4 / 2", 3},
+		{"7 % 4 + 1", 4},
+		{"2 ^ 3 ^ 2", 512}, //right associative
+		{"-2 ^ 2", -4},     //^ binds tighter than unary minus
+		{"(-2) ^ 2", 4},
+		{"2 ^ -1", 0.5},
+		{"2 * -3", -6},
+		{"--3", 3},
+		{"+4", 4},
+		{"((2 + 3) * (4 - 1)) ^ 2", 225},
+		{"1.5e3 + 1", 1501},
+		{"2 * pi", 2 * math.Pi},
+		{"e", math.E},
+		{"log(1000) + ln(e)", 4},
+		{"abs(-3) + floor(2.7) + ceil(2.1) + round(2.5)", 11},
+		{"sqrt(9 + 16)", 5},
+		{"SQRT(4)", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evaluateExpression(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string //a substring of the error
+	}{
+		{"", "empty"},
+		{"   ", "empty"},
+		{"1 / 0", "division by zero"},
+		{"5 % (2 - 2)", "division by zero"},
+		{"(1 + 2", "missing )"},
+		{"1 + 2)", `unexpected ')'`},
+		{"2 3", `unexpected '3'`},
+		{"2 * ", "ends too early"},
+		{"foo(2)", `unknown name "foo"`},
+		{"sqrt 4", "needs its argument in parentheses"},
+		{"sqrt(4", "missing ) after the argument of sqrt"},
+		{"1.2.3", "bad number"},
+		{"2e", `unexpected 'e'`},
+		{"#", `unexpected '#'`},
+		{strings.Repeat("1+", maxExpressionLen), "longer than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			v, err := evaluateExpression(tt.expr)
+			if err == nil {
+				t.Fatalf("want an error, got %g", v)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
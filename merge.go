@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// -------------------------- MERGE (subcommand) --------------------------
+
+// runMerge combines two transcripts saved with /save into one, which can be loaded back with /load
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	mode := fs.String("mode", "interleave", "interleave: order the turns of both by time, append: the second after the first")
+	outPath := fs.String("out", "merged.json", "where to write the merged transcript (.json or .md)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] <first.json> <second.json>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("give exactly two JSON transcripts")
+	}
+	if *mode != "interleave" && *mode != "append" {
+		return fmt.Errorf("-mode must be interleave or append, got %q", *mode)
+	}
+
+	a, err := loadConversationLog(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadConversationLog(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	merged := mergeConversationLogs(a, b, *mode == "interleave")
+	if err = merged.save(*outPath); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d + %d entries into %d in %s (the turns both start with are kept once)\n", len(a.Entries), len(b.Entries), len(merged.Entries), *outPath)
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package mockrealtime is a small fake of the OpenAI Realtime API (beta event names) for running the CLI without an API key.
+// It speaks just enough of the protocol for the chat flow: session.created/updated, conversation.item.created,
+// and responses streamed as response.text.delta events. A user message that mentions "multiply" and two numbers
+// gets a multiply function call first, and the function_call_output it receives back is echoed in the follow-up answer.
+package mockrealtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"nhooyr.io/websocket"
+)
+
+var numberPattern = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+
+// Handler upgrades every request to a websocket and runs one mock session on it. The model and API key are not checked.
+func Handler() http.Handler {
+	var sessions atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.SetReadLimit(16 << 20)
+		s := &session{conn: c, id: fmt.Sprintf("sess_mock_%d", sessions.Add(1))}
+		err = s.run(r.Context())
+		if websocket.CloseStatus(err) == -1 && err != nil {
+			slog.Warn("mockrealtime: session ended", "session", s.id, "err", err)
+		}
+	})
+}
+
+type session struct {
+	conn      *websocket.Conn
+	id        string
+	responses int
+	items     int
+	lastInput string //text the next response answers to
+}
+
+func (s *session) run(ctx context.Context) error {
+	defer s.conn.CloseNow()
+	if err := s.send(ctx, map[string]any{"type": "session.created", "session": map[string]any{"id": s.id, "object": "realtime.session"}}); err != nil {
+		return err
+	}
+	for {
+		_, data, err := s.conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+		var evt map[string]any
+		if err := json.Unmarshal(data, &evt); err != nil {
+			if err := s.sendError(ctx, "invalid_request_error", "invalid JSON: "+err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.handle(ctx, evt); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *session) handle(ctx context.Context, evt map[string]any) error {
+	switch typ, _ := evt["type"].(string); typ {
+	case "session.update":
+		session, _ := evt["session"].(map[string]any)
+		return s.send(ctx, map[string]any{"type": "session.updated", "session": session})
+
+	case "conversation.item.create":
+		item, _ := evt["item"].(map[string]any)
+		if item == nil {
+			return s.sendError(ctx, "invalid_request_error", "missing item")
+		}
+		s.items++
+		if _, ok := item["id"]; !ok {
+			item["id"] = fmt.Sprintf("item_%d", s.items)
+		}
+		switch item["type"] {
+		case "function_call_output":
+			output, _ := item["output"].(string)
+			s.lastInput = "tool output " + output
+		case "message":
+			if item["role"] == "user" {
+				s.lastInput = messageText(item)
+			}
+		}
+		return s.send(ctx, map[string]any{"type": "conversation.item.created", "item": item})
+
+	case "response.create":
+		return s.respond(ctx)
+
+	case "response.cancel":
+		return s.sendError(ctx, "response_cancel_not_active", "there is no active response to cancel")
+
+	default:
+		return nil //events the mock doesnt model are accepted silently
+	}
+}
+
+// respond streams one response: a multiply call when the input asks for it, an echo of the input otherwise
+func (s *session) respond(ctx context.Context) error {
+	s.responses++
+	rid := fmt.Sprintf("resp_%d", s.responses)
+	input := s.lastInput
+	s.lastInput = ""
+
+	if err := s.send(ctx, map[string]any{"type": "response.created", "response": map[string]any{"id": rid, "status": "in_progress"}}); err != nil {
+		return err
+	}
+
+	outputTokens := 0
+	numbers := numberPattern.FindAllString(input, 2)
+	if strings.Contains(strings.ToLower(input), "multiply") && len(numbers) == 2 {
+		item := map[string]any{"id": rid + "_call", "type": "function_call", "name": "multiply", "call_id": "call_" + rid}
+		args := fmt.Sprintf(`{"a":%s,"b":%s}`, numbers[0], numbers[1])
+		events := []map[string]any{
+			{"type": "response.output_item.added", "response_id": rid, "item": item},
+			{"type": "response.function_call_arguments.delta", "response_id": rid, "item_id": item["id"], "call_id": item["call_id"], "delta": args},
+			{"type": "response.output_item.done", "response_id": rid, "item": withField(item, "arguments", args)},
+		}
+		outputTokens = len(args) / 4
+		for _, e := range events {
+			if err := s.send(ctx, e); err != nil {
+				return err
+			}
+		}
+	} else {
+		itemID := rid + "_msg"
+		text := "You said: " + input
+		outputTokens = len(strings.Fields(text))
+		if err := s.send(ctx, map[string]any{"type": "response.output_item.added", "response_id": rid, "item": map[string]any{"id": itemID, "type": "message", "role": "assistant"}}); err != nil {
+			return err
+		}
+		for _, word := range strings.SplitAfter(text, " ") {
+			delta := map[string]any{"type": "response.text.delta", "response_id": rid, "item_id": itemID, "output_index": 0, "content_index": 0, "delta": word}
+			if err := s.send(ctx, delta); err != nil {
+				return err
+			}
+		}
+		if err := s.send(ctx, map[string]any{"type": "response.text.done", "response_id": rid, "item_id": itemID, "text": text}); err != nil {
+			return err
+		}
+		if err := s.send(ctx, map[string]any{"type": "response.output_item.done", "response_id": rid, "item": map[string]any{"id": itemID, "type": "message", "role": "assistant"}}); err != nil {
+			return err
+		}
+	}
+	// a token per word (or per 4 characters of arguments) is far from a real tokenizer but enough to exercise the usage accounting
+	inputTokens := len(strings.Fields(input))
+	usage := map[string]any{
+		"total_tokens": inputTokens + outputTokens, "input_tokens": inputTokens, "output_tokens": outputTokens,
+		"input_token_details":  map[string]any{"text_tokens": inputTokens, "audio_tokens": 0, "cached_tokens": 0},
+		"output_token_details": map[string]any{"text_tokens": outputTokens, "audio_tokens": 0},
+	}
+	return s.send(ctx, map[string]any{"type": "response.done", "response": map[string]any{"id": rid, "status": "completed", "usage": usage}})
+}
+
+func (s *session) send(ctx context.Context, evt map[string]any) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return s.conn.Write(ctx, websocket.MessageText, data)
+}
+
+func (s *session) sendError(ctx context.Context, code, message string) error {
+	return s.send(ctx, map[string]any{"type": "error", "error": map[string]any{"type": "invalid_request_error", "code": code, "message": message}})
+}
+
+// messageText joins the text parts of a message item
+func messageText(item map[string]any) string {
+	parts, _ := item["content"].([]any)
+	var texts []string
+	for _, p := range parts {
+		part, _ := p.(map[string]any)
+		if text, ok := part["text"].(string); ok {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+func withField(m map[string]any, key string, value any) map[string]any {
+	out := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/mockrealtime"
+)
+
+// -------------------------- MOCK SERVER (subcommand) --------------------------
+
+// runMockServer serves the fake realtime API so the whole client flow can run without an API key (CI, demos, offline work)
+func runMockServer(args []string) error {
+	fs := flag.NewFlagSet("mock-server", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8089", "address to listen on")
+	fs.Parse(args)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mock realtime API listening, point the CLI at it with: REALTIME_CLI_URL=ws://%s/v1/realtime OPENAI_API_KEY=mock\n", ln.Addr())
+	srv := &http.Server{Handler: mockrealtime.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	return srv.Serve(ln)
+}
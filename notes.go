@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- MEETING NOTES (subcommand) --------------------------
+
+// transcription has no speaker labels, so the model is asked to infer speaker changes itself and keep the labels stable
+const notesInstructions = "You are a meeting assistant. You receive the transcript of a meeting in parts, as it happens. " +
+	"The transcript has no speaker labels: when the wording makes a change of speaker clear, refer to the speakers as Speaker A, Speaker B and so on, " +
+	"and keep those labels consistent for the whole meeting. Never invent content that is not in the transcript."
+
+const (
+	runningSummaryPrompt = "New transcript since the last update:\n\n%s\n\nGive a short running summary of the meeting so far and list any new action items."
+	finalNotesPrompt     = "%sThe meeting is over. Write the final meeting notes in Markdown with the sections: Summary, Decisions, Action items (with the owner when known) and Open questions."
+)
+
+// runNotes transcribes a meeting, asks a text session for running summaries every few minutes and writes a notes document at the end
+func runNotes(args []string) error {
+	fs := flag.NewFlagSet("notes", flag.ExitOnError)
+	opts := addTranscriptionFlags(fs)
+	every := fs.Duration("every", 5*time.Minute, "how often to ask for a running summary (0 disables them)")
+	outPath := fs.String("out", "meeting-notes.md", "where to write the final notes")
+	chatModel := fs.String("chat-model", config.model, "model used for the summaries")
+	if err := parseTranscriptionArgs(fs, opts, args); err != nil {
+		return err
+	}
+
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return err
+	}
+	apiKey := keys.pick().secret //these modes hold a single connection, so there is nothing to rotate
+	readLimit, err := loadReadLimit()
+	if err != nil {
+		return err
+	}
+
+	s, err := openNotesSession(apiKey, *chatModel, readLimit)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	started := time.Now()
+	var transcript []string
+	var chunk strings.Builder
+	lastSummary := time.Now()
+
+	err = runTranscription(opts, func(segment string) error {
+		transcript = append(transcript, segment)
+		chunk.WriteString(segment + "\n")
+		if *every <= 0 || time.Since(lastSummary) < *every {
+			return nil
+		}
+		lastSummary = time.Now()
+		fmt.Println("\n--- running summary ---")
+		_, err := s.ask(fmt.Sprintf(runningSummaryPrompt, chunk.String()), 30*time.Second)
+		chunk.Reset()
+		fmt.Println("-----------------------")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(transcript) == 0 {
+		return errors.New("nothing was transcribed, no notes written")
+	}
+
+	var rest string
+	if chunk.Len() > 0 {
+		rest = "The last part of the transcript:\n\n" + chunk.String() + "\n"
+	}
+	fmt.Println("\n--- final notes ---")
+	notes, err := s.ask(fmt.Sprintf(finalNotesPrompt, rest), 2*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	doc := fmt.Sprintf("# Meeting notes (%s)\n\n%s\n\n## Transcript\n\n%s\n", started.Format("2006-01-02 15:04"), notes, strings.Join(transcript, "\n\n"))
+	if err = os.WriteFile(*outPath, []byte(doc), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Notes written to %s\n", *outPath)
+	return nil
+}
+
+// notesSession is the text session the transcript parts are sent to
+type notesSession struct {
+	conn          *realtimeConn
+	eventsCh      <-chan map[string]any
+	errsCh        <-chan error
+	cancelSession context.CancelFunc
+}
+
+func openNotesSession(apiKey, model string, readLimit int64) (*notesSession, error) {
+	dialCtx, cancelDial := opContext("dial", 30*time.Second)
+	conn, err := dialRealtime(dialCtx, apiKey, model, readLimit)
+	cancelDial()
+	if err != nil {
+		return nil, fmt.Errorf("dial failed: %w", err)
+	}
+
+	sessionCtx, cancelSession := context.WithCancel(context.Background())
+	eventsCh, errsCh := startReader(sessionCtx, conn)
+	s := &notesSession{conn: conn, eventsCh: eventsCh, errsCh: errsCh, cancelSession: cancelSession}
+
+	createdCtx, cancelCreated := opContext("wait for session", 10*time.Second)
+	_, err = waitForEventTypeFromChan(createdCtx, eventsCh, "session.created")
+	cancelCreated()
+	if err != nil {
+		s.close()
+		return nil, sessionError(errsCh, err)
+	}
+
+	update, err := events.NewSessionConfig().Instructions(notesInstructions).Build()
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	updCtx, cancelUpd := opContext("session update", 10*time.Second)
+	err = marshalAndSend(updCtx, conn, update)
+	cancelUpd()
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ask sends the prompt as a user turn and streams the answer to the terminal
+func (s *notesSession) ask(prompt string, timeout time.Duration) (string, error) {
+	sendCtx, cancelSend := opContext("send transcript", 30*time.Second)
+	itemsSent, err := sendUserInput(sendCtx, s.conn, prompt)
+	cancelSend()
+	if err != nil {
+		return "", sessionError(s.errsCh, err)
+	}
+
+	waitCtx, cancelWait := opContext("wait for conversation item", 30*time.Second)
+	for range itemsSent {
+		if _, err = waitForEventTypeFromChan(waitCtx, s.eventsCh, "conversation.item.created"); err != nil {
+			cancelWait()
+			return "", sessionError(s.errsCh, err)
+		}
+	}
+	cancelWait()
+
+	reqCtx, cancelReq := opContext("request summary", 30*time.Second)
+	err = requestTextResponse(reqCtx, s.conn, notesInstructions)
+	cancelReq()
+	if err != nil {
+		return "", sessionError(s.errsCh, err)
+	}
+
+	streamCtx, cancelStream := opContext("stream summary", timeout)
+	text, _, err := streamAssistantTextFromChan(streamCtx, s.conn, s.eventsCh, nil, newTerminalSink(os.Stdout))
+	cancelStream()
+	if err != nil {
+		return "", sessionError(s.errsCh, err)
+	}
+	return text, nil
+}
+
+func (s *notesSession) close() {
+	s.conn.Close(websocket.StatusNormalClosure, "") //before cancelling the reader, a cancelled read tears the connection down without a close frame
+	s.cancelSession()
+}
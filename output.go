@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// -------------------------- OUTPUT --------------------------
+
+// OutputSink is where the stream handler shows a response, piece by piece with its message boundaries. the chat wraps
+// the terminal in a terminalSink, the serve mode streams to its SSE writer and a /revise is shown as a diff afterwards,
+// so its own stream goes to a discardSink
+type OutputSink interface {
+	StartMessage()     //a text message of the response starts, a response can hold several
+	Delta(text string) //the next piece of the message, after the -stop strings are cut off
+	EndMessage()
+	Cancelled() //the user cancelled the response, nothing more of it is shown
+}
+
+// terminalSink renders the answers of the chat the way the terminal shows them, with the "Chatbot> " prefix, the colors
+// and the markdown
+type terminalSink struct {
+	out io.Writer
+	md  *markdownRenderer //nil prints the text as it comes
+}
+
+func newTerminalSink(out io.Writer) *terminalSink {
+	s := &terminalSink{out: colors.writer(colorAssistant, out)}
+	if renderMarkdown {
+		s.md = newMarkdownRenderer(s.out)
+	}
+	return s
+}
+
+func (s *terminalSink) StartMessage() { fmt.Fprint(s.out, "Chatbot> ") }
+
+func (s *terminalSink) Delta(text string) {
+	if s.md != nil { //rendered line by line
+		s.md.write(text)
+		return
+	}
+	fmt.Fprint(s.out, text)
+}
+
+func (s *terminalSink) EndMessage() {
+	s.md.flush()
+	fmt.Fprintln(s.out)
+}
+
+func (s *terminalSink) Cancelled() {
+	s.md.flush()
+	fmt.Fprintln(s.out, "\n(cancelled)")
+}
+
+// discardSink drops the response, the caller shows the answer its own way
+type discardSink struct{}
+
+func (discardSink) StartMessage()     {}
+func (discardSink) Delta(text string) {}
+func (discardSink) EndMessage()       {}
+func (discardSink) Cancelled()        {}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recordingSink keeps the calls of the stream handler, the deltas of a message are joined since their split doesn't matter
+type recordingSink struct {
+	calls []string
+}
+
+func (r *recordingSink) StartMessage() { r.calls = append(r.calls, "start") }
+
+func (r *recordingSink) Delta(text string) {
+	if n := len(r.calls) - 1; n >= 0 && strings.HasPrefix(r.calls[n], "delta:") {
+		r.calls[n] += text
+		return
+	}
+	r.calls = append(r.calls, "delta:"+text)
+}
+
+func (r *recordingSink) EndMessage() { r.calls = append(r.calls, "end") }
+func (r *recordingSink) Cancelled()  { r.calls = append(r.calls, "cancelled") }
+
+// the events of the response r1
+func textDelta(item, text string) map[string]any {
+	return map[string]any{"type": "response.text.delta", "response_id": "r1", "item_id": item, "delta": text}
+}
+
+func messageItem(typ, item string) map[string]any {
+	return map[string]any{"type": typ, "response_id": "r1", "item": map[string]any{"id": item, "type": "message"}}
+}
+
+func responseDone(status string) map[string]any {
+	return map[string]any{"type": "response.done", "response": map[string]any{"id": "r1", "status": status}}
+}
+
+// streamEvents runs the stream handler over the events one at a time, without a connection. a nil event is a Ctrl+C
+func streamEvents(t *testing.T, evts []map[string]any) (*recordingSink, string, error) {
+	t.Helper()
+	eventsCh := make(chan map[string]any)
+	interrupts := make(chan os.Signal)
+	sink := &recordingSink{}
+	type result struct {
+		answer string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		answer, _, err := streamAssistantTextFromChan(context.Background(), nil, eventsCh, interrupts, sink)
+		done <- result{answer, err}
+	}()
+	created := map[string]any{"type": "response.created", "response": map[string]any{"id": "r1"}}
+	for _, evt := range append([]map[string]any{created}, evts...) {
+		if evt == nil {
+			interrupts <- os.Interrupt
+			continue
+		}
+		eventsCh <- evt
+	}
+	res := <-done
+	return sink, res.answer, res.err
+}
+
+func TestStreamSinkOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		evts    []map[string]any
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "one message",
+			evts: []map[string]any{
+				messageItem("response.output_item.added", "m1"),
+				textDelta("m1", "Hello "), textDelta("m1", "world"),
+				messageItem("response.output_item.done", "m1"),
+				responseDone("completed"),
+			},
+			want: []string{"start", "delta:Hello world", "end"},
+		},
+		{
+			name: "two messages",
+			evts: []map[string]any{
+				textDelta("m1", "first"),
+				messageItem("response.output_item.done", "m1"),
+				textDelta("m2", "second"),
+				responseDone("completed"), //without output_item.done the message still ends
+			},
+			want: []string{"start", "delta:first", "end", "start", "delta:second", "end"},
+		},
+		{
+			name: "cancelled",
+			evts: []map[string]any{
+				textDelta("m1", "Hello"),
+				nil,
+				textDelta("m1", " dropped"),
+				responseDone("cancelled"),
+			},
+			want:    []string{"start", "delta:Hello", "cancelled"},
+			wantErr: errResponseCancelled,
+		},
+		{
+			name:    "cancelled before the text",
+			evts:    []map[string]any{nil, textDelta("m1", "dropped"), responseDone("cancelled")},
+			want:    []string{"cancelled"},
+			wantErr: errResponseCancelled,
+		},
+		{
+			name: "other response ignored",
+			evts: []map[string]any{
+				{"type": "response.text.delta", "response_id": "r0", "item_id": "old", "delta": "late"},
+				textDelta("m1", "mine"),
+				responseDone("completed"),
+			},
+			want: []string{"start", "delta:mine", "end"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, _, err := streamEvents(t, tt.evts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(sink.calls, tt.want) {
+				t.Errorf("sink got %q, want %q", sink.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamStop(t *testing.T) {
+	stops := config.stops
+	config.stops = []string{"STOP"}
+	t.Cleanup(func() { config.stops = stops })
+
+	sink, answer, err := streamEvents(t, []map[string]any{
+		textDelta("m1", "one two ST"), //the stop string is split over two deltas
+		textDelta("m1", "OP three"),
+		textDelta("m1", " four"),
+		messageItem("response.output_item.done", "m1"),
+		responseDone("cancelled"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "one two " {
+		t.Errorf("answer = %q, want the text before the stop string", answer)
+	}
+	if want := []string{"start", "delta:one two ", "end"}; !slices.Equal(sink.calls, want) {
+		t.Errorf("sink got %q, want %q", sink.calls, want)
+	}
+}
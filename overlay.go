@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- OVERLAY (-overlay, live captions for OBS) --------------------------
+
+// -overlay 127.0.0.1:8092 serves a captions page at / (add it to OBS as a browser source) and pushes the chat to every
+// client of /ws as JSON messages: "user" with the input, "delta" with the answer as it streams, "done" when the answer
+// is over, and "level" with the loudness (0..1) of the spoken answer, for a level meter
+const overlayClientBuffer = 256 //messages a slow client may lag behind, it misses the newer ones after that
+
+type overlayEvent struct {
+	Type  string  `json:"type"`
+	Text  string  `json:"text,omitempty"`
+	Level float64 `json:"level,omitempty"`
+}
+
+// overlayHub fans the events out to the connected pages. a nil hub drops them
+type overlayHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+var overlay *overlayHub
+
+func startOverlay(addr string) (*overlayHub, error) {
+	h := &overlayHub{clients: map[chan []byte]struct{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, overlayPage)
+	})
+	mux.HandleFunc("/ws", h.handleClient)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Overlay: add http://%s/ as a browser source in OBS.\n", ln.Addr())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			slog.Error("overlay server stopped", "addr", addr, "err", err)
+		}
+	}()
+	return h, nil
+}
+
+func (h *overlayHub) handleClient(w http.ResponseWriter, r *http.Request) {
+	c, err := websocket.Accept(w, r, nil) //the page is served from the same host, so the default origin check lets it in
+	if err != nil {
+		return
+	}
+	defer c.CloseNow()
+	send := make(chan []byte, overlayClientBuffer)
+	h.mu.Lock()
+	h.clients[send] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, send)
+		h.mu.Unlock()
+	}()
+
+	ctx := c.CloseRead(r.Context()) //the page never sends anything, this notices when it goes away
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-send:
+			writeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := c.Write(writeCtx, websocket.MessageText, msg)
+			cancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *overlayHub) publish(evt overlayEvent) {
+	if h == nil {
+		return
+	}
+	msg, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for send := range h.clients {
+		select {
+		case send <- msg:
+		default: //never hold up the chat for a slow page
+		}
+	}
+}
+
+// audioLevel publishes the loudness of a base64 PCM16 response.audio.delta
+func (h *overlayHub) audioLevel(deltaB64 string) {
+	if h == nil {
+		return
+	}
+	pcm, err := base64.StdEncoding.DecodeString(deltaB64)
+	if err != nil || len(pcm) < 2 {
+		return
+	}
+	var sum float64
+	n := len(pcm) / 2
+	for i := 0; i < n; i++ {
+		s := float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / math.MaxInt16
+		sum += s * s
+	}
+	h.publish(overlayEvent{Type: "level", Level: math.Round(math.Sqrt(sum/float64(n))*1000) / 1000})
+}
+
+// overlayPage shows the last question and the answer as it streams on a transparent background, the answer fades
+// out a while after it is done
+const overlayPage = `<!doctype html>
+<html><head><meta charset="utf-8"><title>realtime-cli overlay</title>
+<style>
+body { margin: 0; background: transparent; font: 600 32px/1.35 system-ui, sans-serif; color: #fff; }
+#box { position: fixed; left: 4%; right: 4%; bottom: 6%; padding: 16px 24px; border-radius: 12px;
+       background: rgba(0,0,0,.6); text-shadow: 0 2px 4px #000; transition: opacity .6s; opacity: 0; }
+#user { font-size: 22px; color: #9cf; }
+#level { height: 6px; margin-top: 10px; background: #6f6; width: 0; transition: width .1s; }
+</style></head>
+<body><div id="box"><div id="user"></div><div id="answer"></div><div id="level"></div></div>
+<script>
+const box = document.getElementById("box"), user = document.getElementById("user"),
+      answer = document.getElementById("answer"), level = document.getElementById("level");
+let hide;
+function show() { clearTimeout(hide); box.style.opacity = 1; }
+function connect() {
+  const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+  ws.onmessage = (m) => {
+    const e = JSON.parse(m.data);
+    if (e.type === "user") { show(); user.textContent = e.text; answer.textContent = ""; }
+    if (e.type === "delta") { show(); answer.textContent += e.text; }
+    if (e.type === "level") { level.style.width = Math.min(100, e.level * 300) + "%"; }
+    if (e.type === "done") { level.style.width = 0; hide = setTimeout(() => box.style.opacity = 0, 8000); }
+  };
+  ws.onclose = () => setTimeout(connect, 1000);
+}
+connect();
+</script></body></html>
+`
@@ -0,0 +1,7 @@
+package main
+
+// default audio commands, both speak raw PCM16 mono 24kHz on stdout/stdin (sox, e.g. from homebrew)
+const (
+	defaultMicCommand    = "rec -q -t raw -b 16 -e signed -c 1 -r 24000 -"
+	defaultPlayerCommand = "play -q -t raw -b 16 -e signed -c 1 -r 24000 -"
+)
@@ -0,0 +1,7 @@
+package main
+
+// default audio commands, both speak raw PCM16 mono 24kHz on stdout/stdin (alsa-utils)
+const (
+	defaultMicCommand    = "arecord -q -f S16_LE -r 24000 -c 1 -t raw"
+	defaultPlayerCommand = "aplay -q -f S16_LE -r 24000 -c 1 -t raw"
+)
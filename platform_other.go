@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+// default audio commands, both speak raw PCM16 mono 24kHz on stdout/stdin (sox)
+const (
+	defaultMicCommand    = "rec -q -t raw -b 16 -e signed -c 1 -r 24000 -"
+	defaultPlayerCommand = "play -q -t raw -b 16 -e signed -c 1 -r 24000 -"
+)
@@ -0,0 +1,8 @@
+package main
+
+// default audio commands, both speak raw PCM16 mono 24kHz on stdout/stdin (ffmpeg).
+// dshow needs the name of the capture device, list them with: ffmpeg -list_devices true -f dshow -i dummy
+const (
+	defaultMicCommand    = `ffmpeg -loglevel quiet -f dshow -i audio="Microphone" -ac 1 -ar 24000 -f s16le -`
+	defaultPlayerCommand = "ffplay -nodisp -autoexit -loglevel quiet -f s16le -ar 24000 -ac 1 -"
+)
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// -------------------------- PODCAST (-podcast, recording of a voice session) --------------------------
+
+// -podcast chat.wav records a chat with spoken answers: chat.wav holds every question as a pause and every answer as it
+// was spoken, chat.vtt and chat.srt caption both sides. the questions are typed, so they are only in the captions.
+// the timeline is the one of the audio and not the wall clock, the time spent typing or waiting for an answer is left out
+const (
+	podcastWordPause = 300 * time.Millisecond //silence per word of a question, the time to read its caption
+	podcastMinPause  = 2 * time.Second
+)
+
+type podcastCue struct {
+	start, end time.Duration
+	speaker    string
+	text       string
+}
+
+// podcastRecorder writes the audio as it comes and the captions when the chat ends. nil when -podcast is off,
+// every method is safe to call on a nil recorder
+type podcastRecorder struct {
+	path        string
+	f           *os.File
+	written     int64 //bytes of audio after the header
+	answerStart int64 //where the audio of the current response starts, -1 before its first delta
+	cues        []podcastCue
+	err         error //the first write error, the recording stops there
+}
+
+var podcast *podcastRecorder
+
+func openPodcast(path string) (*podcastRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Write(wavHeader(0)); err != nil { //the sizes are filled in by close
+		f.Close()
+		return nil, err
+	}
+	return &podcastRecorder{path: path, f: f, answerStart: -1}, nil
+}
+
+func (p *podcastRecorder) at(bytes int64) time.Duration {
+	return time.Duration(bytes) * time.Second / audioBytesPerSecond
+}
+
+func (p *podcastRecorder) write(pcm []byte) {
+	if p.err != nil {
+		return
+	}
+	if _, p.err = p.f.Write(pcm); p.err != nil {
+		slog.Warn("podcast: writing the audio failed, the recording stops here", "file", p.path, "err", p.err)
+		return
+	}
+	p.written += int64(len(pcm))
+}
+
+// pause writes the silence a caption of text is shown for
+func (p *podcastRecorder) pause(speaker, text string) {
+	d := max(podcastMinPause, time.Duration(len(strings.Fields(text)))*podcastWordPause)
+	start := p.written
+	p.write(make([]byte, int64(d.Seconds()*audioBytesPerSecond)&^1)) //whole samples
+	p.cues = append(p.cues, podcastCue{start: p.at(start), end: p.at(p.written), speaker: speaker, text: oneLine(text)})
+}
+
+// question adds the user's input of a turn
+func (p *podcastRecorder) question(text string) {
+	if p == nil || text == "" {
+		return
+	}
+	p.pause("User", text)
+}
+
+// audio appends one base64 response.audio.delta
+func (p *podcastRecorder) audio(deltaB64 string) {
+	if p == nil || deltaB64 == "" {
+		return
+	}
+	pcm, err := base64.StdEncoding.DecodeString(deltaB64)
+	if err != nil {
+		return //the speaker already warned about it
+	}
+	if p.answerStart < 0 {
+		p.answerStart = p.written
+	}
+	p.write(pcm)
+}
+
+// answer captions the audio of the response that just ended, a sentence per cue with the time split by length
+func (p *podcastRecorder) answer(text string) {
+	if p == nil {
+		return
+	}
+	start := p.answerStart
+	p.answerStart = -1
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if start < 0 { //text without audio, e.g. the model answered in text only this time
+		p.pause("Assistant", text)
+		return
+	}
+	sentences := splitSentences(oneLine(text))
+	total := 0
+	for _, s := range sentences {
+		total += utf8.RuneCountInString(s)
+	}
+	from, span, done := p.at(start), p.at(p.written)-p.at(start), 0
+	for _, s := range sentences {
+		done += utf8.RuneCountInString(s)
+		to := p.at(start) + span*time.Duration(done)/time.Duration(total)
+		p.cues = append(p.cues, podcastCue{start: from, end: to, speaker: "Assistant", text: s})
+		from = to
+	}
+}
+
+// close fills in the WAV sizes and writes the captions next to the audio
+func (p *podcastRecorder) close() error {
+	if p == nil {
+		return nil
+	}
+	if _, err := p.f.WriteAt(wavHeader(uint32(p.written)), 0); err != nil && p.err == nil {
+		p.err = err
+	}
+	if err := p.f.Close(); err != nil && p.err == nil {
+		p.err = err
+	}
+	if p.err != nil {
+		return p.err
+	}
+	base := strings.TrimSuffix(p.path, filepath.Ext(p.path))
+	if err := os.WriteFile(base+".vtt", []byte(p.webVTT()), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".srt", []byte(p.srt()), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Podcast saved to %s (%s), captions in %s.vtt and %s.srt.\n", p.path, p.at(p.written).Round(time.Second), base, base)
+	return nil
+}
+
+func (p *podcastRecorder) webVTT() string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	for _, c := range p.cues {
+		fmt.Fprintf(&b, "%s --> %s\n<v %s>%s\n\n", cueTime(c.start, "."), cueTime(c.end, "."), c.speaker, escape.Replace(c.text))
+	}
+	return b.String()
+}
+
+func (p *podcastRecorder) srt() string {
+	var b strings.Builder
+	for i, c := range p.cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s: %s\n\n", i+1, cueTime(c.start, ","), cueTime(c.end, ","), c.speaker, c.text)
+	}
+	return b.String()
+}
+
+// cueTime formats hh:mm:ss followed by the milliseconds, WebVTT separates them with a dot and SRT with a comma
+func cueTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// oneLine joins the lines of a text, a caption is a single line of plain words
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
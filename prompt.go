@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// -------------------------- PROMPT INPUT --------------------------
+
+var errIdle = errors.New("no input for too long")
+
+// promptReader reads the user's lines. with a session clock or an idle limit the read runs in a goroutine so the wait can end
+// without a line, the read stays pending and the next readLine picks it up (a second read of the same reader would race it)
+type promptReader struct {
+	r       *bufio.Reader
+	clock   *sessionClock //nil when -max-session is not set
+	idle    time.Duration //0 waits forever
+	pending chan lineResult
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+// readLine returns the next line, errSessionOver when the session time is up and errIdle after idle without input
+func (p *promptReader) readLine(prompt string) (string, error) {
+	if p.clock == nil && p.idle == 0 && p.pending == nil {
+		return p.r.ReadString('\n')
+	}
+	if p.pending == nil {
+		lines := make(chan lineResult, 1)
+		go func() {
+			line, err := p.r.ReadString('\n')
+			lines <- lineResult{line, err}
+		}()
+		p.pending = lines
+	}
+	var idle <-chan time.Time
+	if p.idle > 0 {
+		timer := time.NewTimer(p.idle)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	for {
+		select {
+		case res := <-p.pending:
+			p.pending = nil
+			return res.line, res.err
+		case <-p.clock.warnC():
+			p.clock.showWarning(prompt)
+		case <-p.clock.endC():
+			fmt.Println()
+			return "", errSessionOver
+		case <-idle:
+			return "", errIdle
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- PROTOCOL COMPATIBILITY --------------------------
+
+// the realtime API has two variants on the same URL: the beta one (selected with the OpenAI-Beta header) and GA.
+// the rest of the code only speaks the beta names, this file translates to/from GA when the session turns out to be GA.
+const (
+	protocolBeta = "beta"
+	protocolGA   = "ga"
+)
+
+const protocolEnvVar = "REALTIME_CLI_PROTOCOL"
+
+// requestedProtocol is the variant new connections ask for at dial time, each connection then keeps its own
+var requestedProtocol = protocolBeta
+
+// realtimeConn is a websocket with the variant it speaks, the one asked for until session.created tells what the server
+// actually gave us. the variant is per connection: a transcription session is always beta, whatever the chat uses
+type realtimeConn struct {
+	*websocket.Conn
+	protocol string
+}
+
+func loadProtocol() (string, error) {
+	switch p := os.Getenv(protocolEnvVar); p {
+	case "", protocolBeta:
+		return protocolBeta, nil
+	case protocolGA:
+		return protocolGA, nil
+	default:
+		return "", fmt.Errorf("%s must be %q or %q, got %q", protocolEnvVar, protocolBeta, protocolGA, p)
+	}
+}
+
+// detectProtocol records the variant from the session.created event (GA sessions have "type": "realtime", beta ones don't)
+func detectProtocol(sessionCreated map[string]any) string {
+	session, _ := sessionCreated["session"].(map[string]any)
+	if typ, _ := session["type"].(string); typ == "realtime" {
+		return protocolGA
+	}
+	return protocolBeta
+}
+
+// GA server event names and the beta names the stream loop expects
+var gaToBetaEventTypes = map[string]string{
+	"response.output_text.delta":             "response.text.delta",
+	"response.output_text.done":              "response.text.done",
+	"response.output_audio.delta":            "response.audio.delta",
+	"response.output_audio.done":             "response.audio.done",
+	"response.output_audio_transcript.delta": "response.audio_transcript.delta",
+	"response.output_audio_transcript.done":  "response.audio_transcript.done",
+	"conversation.item.added":                "conversation.item.created",
+}
+
+// normalizeInbound renames GA event types to their beta names, beta events are returned untouched so this is safe before detection
+func normalizeInbound(evt map[string]any) map[string]any {
+	typ, _ := evt["type"].(string)
+	if betaType, ok := gaToBetaEventTypes[typ]; ok {
+		evt["type"] = betaType
+	}
+	return evt
+}
+
+// adaptOutbound rewrites a marshalled client event for the negotiated variant of the connection
+// (GA wants a single "output_modalities" instead of "modalities", "max_output_tokens", a session type on session.update and output_text for assistant items)
+func adaptOutbound(payload []byte, protocol string) []byte {
+	if protocol != protocolGA {
+		return payload
+	}
+
+	var evt map[string]any
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return payload
+	}
+	for _, key := range []string{"session", "response"} {
+		obj, ok := evt[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if m, ok := obj["modalities"].([]any); ok {
+			// GA takes a single output modality, audio output always comes with its transcript
+			if slices.Contains(m, any(events.ModalityAudio)) {
+				m = []any{events.ModalityAudio}
+			}
+			obj["output_modalities"] = m
+			delete(obj, "modalities")
+		}
+		if m, ok := obj["max_response_output_tokens"]; ok { //GA renamed the token cap
+			obj["max_output_tokens"] = m
+			delete(obj, "max_response_output_tokens")
+		}
+		if key == "session" {
+			obj["type"] = "realtime"
+		}
+	}
+	// assistant message content is "text" in beta and "output_text" in GA
+	if item, ok := evt["item"].(map[string]any); ok && item["role"] == "assistant" {
+		parts, _ := item["content"].([]any)
+		for _, p := range parts {
+			if part, ok := p.(map[string]any); ok && part["type"] == "text" {
+				part["type"] = "output_text"
+			}
+		}
+	}
+
+	adapted, err := json.Marshal(evt)
+	if err != nil {
+		slog.Warn("protocol: failed to adapt outbound event, sending it as is", "err", err)
+		return payload
+	}
+	return adapted
+}
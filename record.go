@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// -------------------------- RECORD / REPLAY --------------------------
+
+// recordedFrame is one line of a recording, frames that are not valid JSON (e.g. corrupted by the chaos injector) are kept in Raw
+type recordedFrame struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"` //"in" or "out"
+	Event     json.RawMessage `json:"event,omitempty"`
+	Raw       string          `json:"raw,omitempty"`
+}
+
+// frameRecorder appends every websocket frame to an NDJSON file
+type frameRecorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// recorder is nil unless -record was given, record is a no-op on nil
+var recorder *frameRecorder
+
+func openRecorder(path string) (*frameRecorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &frameRecorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *frameRecorder) record(direction string, data []byte) {
+	if r == nil {
+		return
+	}
+	frame := recordedFrame{Time: time.Now(), Direction: direction}
+	if json.Valid(data) {
+		frame.Event = data
+	} else {
+		frame.Raw = string(data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(frame); err != nil {
+		slog.Warn("record: writing the frame failed", "err", err)
+	}
+}
+
+func (r *frameRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.f.Close()
+}
+
+// runReplay renders a recording offline: the user messages are printed like prompts and the recorded server events go through
+// the same stream handler as a live session, so what is printed is what the user saw (no network, no API key)
+func runReplay(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// a response is streamed by its own goroutine, every event is handed to it as it is read so a response of any length
+	// replays. the events outside a response are ignored by the stream handler anyway, they are dropped here
+	var stream chan map[string]any //nil while no response is replayed
+	var streamID string
+	var streamDone chan struct{}
+	endStream := func() {
+		close(stream)
+		<-streamDone
+		stream = nil
+	}
+	defer func() {
+		if stream != nil { //the recording ends in the middle of a response
+			endStream()
+		}
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), int(defaultReadLimit)*2)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		var frame recordedFrame
+		if err = json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		var evt map[string]any
+		if frame.Event == nil || json.Unmarshal(frame.Event, &evt) != nil {
+			fmt.Printf("[%s frame that is not JSON: %q]\n", frame.Direction, frame.Raw)
+			continue
+		}
+
+		typ, _ := evt["type"].(string)
+		switch {
+		case frame.Direction == "out":
+			replayOutbound(typ, evt)
+		case typ == "error": //printed right away, in a live session it would have ended the turn
+			fmt.Printf("[%v]\n", describeServerError(evt))
+		default:
+			evt = normalizeInbound(evt)
+			if typ == "response.created" && stream == nil {
+				stream, streamID, streamDone = make(chan map[string]any), responseIDOf(evt), make(chan struct{})
+				go replayResponse(stream, streamDone)
+			}
+			if stream == nil {
+				continue
+			}
+			select {
+			case stream <- evt:
+			case <-streamDone: //the handler gave up on the response, what is left of it is not shown
+				stream = nil
+				continue
+			}
+			if typ == "response.done" && responseIDOf(evt) == streamID {
+				endStream()
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// replayOutbound prints what the client sent that the user would have seen
+func replayOutbound(typ string, evt map[string]any) {
+	if typ != "conversation.item.create" {
+		return
+	}
+	item, _ := evt["item"].(map[string]any)
+	switch item["type"] {
+	case "message":
+		if item["role"] != "user" {
+			return
+		}
+		parts, _ := item["content"].([]any)
+		for _, p := range parts {
+			if part, ok := p.(map[string]any); ok {
+				text, _ := part["text"].(string)
+				fmt.Printf("You> %s\n", text)
+			}
+		}
+	case "function_call_output":
+		fmt.Printf("[tool output %v]\n", item["output"])
+	}
+}
+
+// replayResponse runs the stream handler over the events of one response as runReplay reads them, done is closed when it returns
+func replayResponse(inbound <-chan map[string]any, done chan<- struct{}) {
+	defer close(done)
+	_, calls, err := streamAssistantTextFromChan(context.Background(), nil, inbound, nil, newTerminalSink(os.Stdout))
+	if err != nil && !errors.Is(err, errResponseCancelled) {
+		fmt.Printf("[%v]\n", err)
+	}
+	for _, c := range calls {
+		fmt.Printf("[tool call %s %s]\n", c.name, c.args)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayLongResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "long.ndjson")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	frame := func(evt map[string]any) {
+		b, err := json.Marshal(evt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(recordedFrame{Time: time.Now(), Direction: "in", Event: b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frame(map[string]any{"type": "response.created", "response": map[string]any{"id": "r1"}})
+	for range 5000 { //more events than a buffered channel would hold
+		frame(textDelta("m1", "x"))
+	}
+	frame(responseDone("completed"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- runReplay(path) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the replay of a long response did not finish")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- REGIONS (endpoint selection + latency probe) --------------------------
+
+// more endpoints (EU data residency, gateways...) can be added as "name=url" pairs, comma separated.
+// -region picks one by name, "auto" dials every one and keeps the fastest handshake
+const (
+	regionsEnvVar    = "REALTIME_CLI_REGIONS"
+	regionAuto       = "auto"
+	regionProbeLimit = 5 * time.Second
+)
+
+type region struct {
+	name, url string
+}
+
+func builtinRegions() []region {
+	return []region{
+		{"us", realtimeURL},
+		{"eu", "wss://eu.api.openai.com/v1/realtime"}, //for projects with EU data residency
+	}
+}
+
+// loadRegions returns the built in regions plus the configured ones, a configured name replaces a built in one
+func loadRegions() ([]region, error) {
+	regions := builtinRegions()
+	raw := os.Getenv(regionsEnvVar)
+	for _, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, url, ok := strings.Cut(pair, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || name == "" || name == regionAuto || !strings.HasPrefix(url, "ws") {
+			return nil, fmt.Errorf("%s must be name=wss://url pairs separated by commas, got %q", regionsEnvVar, pair)
+		}
+		i := slices.IndexFunc(regions, func(r region) bool { return r.name == name })
+		if i >= 0 {
+			regions[i].url = url
+		} else {
+			regions = append(regions, region{name, url})
+		}
+	}
+	return regions, nil
+}
+
+// applyRegion points config.url at the region named by -region, without one the configured url is used as is
+func applyRegion(apiKey string, readLimit int64) error {
+	if config.region == "" {
+		return nil
+	}
+	regions, err := loadRegions()
+	if err != nil {
+		return err
+	}
+	if config.region != regionAuto {
+		i := slices.IndexFunc(regions, func(r region) bool { return r.name == config.region })
+		if i < 0 {
+			return fmt.Errorf("unknown region %q (known: %s, %s)", config.region, regionNames(regions), regionAuto)
+		}
+		config.url = regions[i].url
+		return nil
+	}
+
+	best, results := probeRegions(apiKey, readLimit, regions)
+	if best == nil {
+		return fmt.Errorf("no region could be reached: %s", results)
+	}
+	fmt.Printf("Using region %s (%s).\n", best.name, results)
+	config.url = best.url
+	return nil
+}
+
+func regionNames(regions []region) string {
+	names := make([]string, len(regions))
+	for i, r := range regions {
+		names[i] = r.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// probeRegions dials every region at once and returns the one with the fastest handshake, with a summary of every result
+func probeRegions(apiKey string, readLimit int64, regions []region) (*region, string) {
+	latencies := make([]time.Duration, len(regions))
+	errs := make([]error, len(regions))
+	var wg sync.WaitGroup
+	for i, r := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), regionProbeLimit)
+			defer cancel()
+			started := time.Now()
+			conn, err := dialRealtimeURL(ctx, apiKey, fmt.Sprint(r.url, "?model=", config.model), requestedProtocol, readLimit)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			latencies[i] = time.Since(started)
+			conn.Close(websocket.StatusNormalClosure, "")
+		}()
+	}
+	wg.Wait()
+
+	var best *region
+	var bestLatency time.Duration
+	results := make([]string, len(regions))
+	for i := range regions {
+		if errs[i] != nil {
+			slog.Warn("region probe failed", "region", regions[i].name, "url", regions[i].url, "err", errs[i])
+			results[i] = regions[i].name + " unreachable"
+			continue
+		}
+		slog.Debug("region probe", "region", regions[i].name, "handshake", latencies[i])
+		results[i] = fmt.Sprintf("%s %s", regions[i].name, latencies[i].Round(time.Millisecond))
+		if best == nil || latencies[i] < bestLatency {
+			best, bestLatency = &regions[i], latencies[i]
+		}
+	}
+	return best, strings.Join(results, ", ")
+}
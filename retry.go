@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- WRITE RETRY --------------------------
+
+// a write that fails on a transient network error is retried a few times before the turn gives up (and the session reconnects)
+const (
+	writeRetriesEnvVar   = "REALTIME_CLI_WRITE_RETRIES"
+	defaultWriteRetries  = 2
+	writeRetryBaseDelay  = 200 * time.Millisecond
+	writeRetryMaxBackoff = 2 * time.Second
+)
+
+// frameWriter is the part of the connection a retried write needs
+type frameWriter interface {
+	Write(ctx context.Context, typ websocket.MessageType, p []byte) error
+}
+
+// parseWriteRetries reads write_retries of the config file or the environment
+func parseWriteRetries(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a number >= 0 (0 disables the retries), got %q", name, value)
+	}
+	return n, nil
+}
+
+// writeWithRetry writes one frame, retrying up to config.writeRetries times with jittered exponential backoff while the
+// error is transient and ctx allows it
+func writeWithRetry(ctx context.Context, w frameWriter, frame []byte) error {
+	delay := writeRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := w.Write(ctx, websocket.MessageText, frame)
+		if err == nil || attempt >= config.writeRetries || !isTransientWriteError(ctx, err) {
+			return err
+		}
+		wait := delay/2 + rand.N(delay/2+1)
+		slog.Warn("write failed, retrying", "attempt", attempt+1, "of", config.writeRetries, "wait", wait, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, writeRetryMaxBackoff)
+	}
+}
+
+// isTransientWriteError only accepts timeouts of the network layer: a closed or reset connection can't take another write
+// (the session reconnects and replays the turn for those) and the caller's own deadline or cancellation must not be ignored
+func isTransientWriteError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
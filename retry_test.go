@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"nhooyr.io/websocket"
+)
+
+// timeoutError is a network error that timed out, like a write deadline hit on a slow link
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// flakyWriter fails its first writes with the given errors, then succeeds
+type flakyWriter struct {
+	errs   []error
+	writes int
+}
+
+func (w *flakyWriter) Write(ctx context.Context, typ websocket.MessageType, p []byte) error {
+	w.writes++
+	if w.writes <= len(w.errs) {
+		return w.errs[w.writes-1]
+	}
+	return nil
+}
+
+func TestIsTransientWriteError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"network timeout", context.Background(), timeoutError{}, true},
+		{"wrapped timeout", context.Background(), fmt.Errorf("write: %w", &net.OpError{Op: "write", Err: timeoutError{}}), true},
+		{"deadline exceeded", context.Background(), os.ErrDeadlineExceeded, true},
+		{"closed connection", context.Background(), fmt.Errorf("write: %w", net.ErrClosed), false},
+		{"reset", context.Background(), errors.New("connection reset by peer"), false},
+		{"cancelled by the caller", cancelled, timeoutError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientWriteError(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("isTransientWriteError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteWithRetry(t *testing.T) {
+	retries := config.writeRetries
+	t.Cleanup(func() { config.writeRetries = retries })
+
+	tests := []struct {
+		name       string
+		retries    int
+		errs       []error
+		wantWrites int
+		wantErr    bool
+	}{
+		{"first write works", 2, nil, 1, false},
+		{"timeout then success", 2, []error{timeoutError{}}, 2, false},
+		{"every retry used", 2, []error{timeoutError{}, timeoutError{}}, 3, false},
+		{"out of retries", 2, []error{timeoutError{}, timeoutError{}, timeoutError{}}, 3, true},
+		{"retries disabled", 0, []error{timeoutError{}}, 1, true},
+		{"closed is not retried", 2, []error{net.ErrClosed}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.writeRetries = tt.retries
+			w := &flakyWriter{errs: tt.errs}
+			err := writeWithRetry(context.Background(), w, []byte(`{}`))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+			if w.writes != tt.wantWrites {
+				t.Errorf("%d writes, want %d", w.writes, tt.wantWrites)
+			}
+		})
+	}
+}
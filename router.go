@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+)
+
+// -------------------------- MODEL ROUTING (-cheap-model, /escalate) --------------------------
+
+// with -cheap-model every turn goes to the cheap model first. an answer that looks unsure is asked again with the strong
+// model (the -model one) in a second connection, which gets the conversation so far. /escalate does the same by hand
+const (
+	escalateCommand        = "/escalate"
+	routeShortAnswerWords  = 5  //an answer shorter than this...
+	routeLongQuestionWords = 15 //...to a question at least this long is escalated
+)
+
+// phrases of an answer that hedges, matched on the lowercased answer
+var uncertaintyPhrases = []string{
+	"i'm not sure", "i am not sure", "not certain", "i don't know", "i do not know", "i'm unable to", "i am unable to",
+	"i can't answer", "i cannot answer", "i don't have enough information", "hard to say", "it's unclear", "it is unclear",
+}
+
+type modelRouter struct {
+	cheap, strong string
+	keys          *apiKeyPool
+	readLimit     int64
+
+	strongSess  *realtimeSession //opened on the first escalation
+	synced      int              //items of the cheap conversation the strong one already has
+	escalatable bool             //the last turn was a finished cheap answer, what /escalate re-asks
+	lastTurn    tokenUsage       //what that answer cost
+}
+
+func newModelRouter(keys *apiKeyPool, cheap, strong string, readLimit int64) *modelRouter {
+	return &modelRouter{cheap: cheap, strong: strong, keys: keys, readLimit: readLimit}
+}
+
+// lowConfidence says why the cheap answer should be asked again, or "" when it looks good enough
+func lowConfidence(input, answer string) string {
+	if strings.TrimSpace(answer) == "" {
+		return "the answer is empty"
+	}
+	lower := strings.ReplaceAll(strings.ToLower(answer), "’", "'")
+	for _, phrase := range uncertaintyPhrases {
+		if strings.Contains(lower, phrase) {
+			return fmt.Sprintf("the answer says %q", phrase)
+		}
+	}
+	if len(strings.Fields(answer)) < routeShortAnswerWords && len(strings.Fields(input)) >= routeLongQuestionWords {
+		return "the answer is very short for the question"
+	}
+	return ""
+}
+
+// runTurn answers with the cheap model and escalates when the answer looks unsure
+func (r *modelRouter) runTurn(cheap *realtimeSession, input, instructions string, out OutputSink) (string, []toolUse, error) {
+	r.escalatable = false
+	before := usage.of(r.cheap)
+	answer, used, err := cheap.runTurn(input, instructions, out)
+	r.lastTurn = usage.of(r.cheap).sub(before)
+	usage.recordRoutedTurn(r.lastTurn, r.cheap, r.strong)
+	if err != nil {
+		return answer, used, err
+	}
+	r.escalatable = true
+	reason := lowConfidence(input, answer)
+	if reason == "" {
+		return answer, used, nil
+	}
+	fmt.Printf("(%s, asking %s)\n", reason, r.strong)
+	return r.escalate(cheap, input, instructions, out)
+}
+
+// escalate asks the last input again with the strong model, the cheap conversation gets the better answer after its own
+func (r *modelRouter) escalate(cheap *realtimeSession, input, instructions string, out OutputSink) (string, []toolUse, error) {
+	if !r.escalatable {
+		return "", nil, fmt.Errorf("there is no answer of %s to escalate", r.cheap)
+	}
+	r.escalatable = false
+	usage.recordEscalation(r.lastTurn, r.strong)
+
+	if r.strongSess == nil {
+		sess, err := openSession(r.keys, r.strong, r.readLimit)
+		if err != nil {
+			return "", nil, fmt.Errorf("opening a session with %s: %w", r.strong, err)
+		}
+		sess.interrupts = cheap.interrupts //one Ctrl+C cancels the conversation whichever model answers
+		r.strongSess = sess
+	} else if err := r.strongSess.checkReader(); err != nil { //it may have dropped while only the cheap model was used
+		return "", nil, err
+	}
+	// everything before the turn that is asked again, the cheap answer itself is left out
+	if err := r.strongSess.importHistory(cheap.history[r.synced : len(cheap.history)-2]); err != nil {
+		return "", nil, err
+	}
+	answer, used, err := r.strongSess.runTurn(input, instructions, out)
+	if errors.Is(err, errResponseCancelled) { //the strong conversation has the turn already, it must not be sent again
+		r.synced = len(cheap.history)
+	}
+	if err != nil {
+		return answer, used, err
+	}
+	if answer != "" {
+		if err := cheap.importHistory([]events.Item{events.AssistantText(answer)}); err != nil {
+			return answer, used, err
+		}
+	}
+	r.synced = len(cheap.history)
+	return answer, used, nil
+}
+
+func (r *modelRouter) close() {
+	if r.strongSess != nil {
+		r.strongSess.close()
+	}
+}
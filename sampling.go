@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+)
+
+// -------------------------- RESPONSE SETTINGS (/set) --------------------------
+
+// "/set temperature 0.8" and "/set max_tokens 500" apply to every response.create that follows,
+// "default" hands the setting back to the session
+const setPrefix = "/set"
+
+type responseSettings struct {
+	temperature float64          //0 keeps the session temperature
+	maxTokens   events.MaxTokens //0 keeps the session cap
+}
+
+var sampling responseSettings
+
+// apply adds the settings to a response.create
+func (r responseSettings) apply(response *events.Response) {
+	response.Temperature = r.temperature
+	response.MaxResponseOutputTokens = r.maxTokens
+}
+
+func (r responseSettings) String() string {
+	temperature, maxTokens := "default", "default"
+	if r.temperature != 0 {
+		temperature = strconv.FormatFloat(r.temperature, 'g', -1, 64)
+	}
+	switch {
+	case r.maxTokens == events.MaxTokensInf:
+		maxTokens = "inf"
+	case r.maxTokens > 0:
+		maxTokens = strconv.Itoa(int(r.maxTokens))
+	}
+	return fmt.Sprintf("temperature=%s max_tokens=%s", temperature, maxTokens)
+}
+
+// set runs "/set [temperature|max_tokens <value>]", without arguments it shows the settings
+func (r *responseSettings) set(args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		fmt.Printf("Response settings: %s\n\n", r)
+		return
+	}
+	if len(fields) != 2 {
+		fmt.Print("Usage: /set temperature <0.6-1.2|default> or /set max_tokens <n|inf|default>\n\n")
+		return
+	}
+	next := *r
+	switch name, value := fields[0], fields[1]; name {
+	case "temperature":
+		next.temperature = 0
+		if value != "default" {
+			t, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				fmt.Printf("Invalid temperature %q.\n\n", value)
+				return
+			}
+			next.temperature = t
+		}
+	case "max_tokens":
+		switch value {
+		case "default":
+			next.maxTokens = 0
+		case "inf":
+			next.maxTokens = events.MaxTokensInf
+		default:
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				fmt.Printf("max_tokens must be a positive number, inf or default, got %q.\n\n", value)
+				return
+			}
+			next.maxTokens = events.MaxTokens(n)
+		}
+	default:
+		fmt.Printf("Unknown setting %q, the settings are temperature and max_tokens.\n\n", name)
+		return
+	}
+	var check events.Response
+	next.apply(&check)
+	if _, err := events.NewResponseCreate(check); err != nil { //the same check the next response.create goes through
+		fmt.Printf("Not changed: %v.\n\n", err)
+		return
+	}
+	*r = next
+	fmt.Printf("Response settings: %s\n\n", r)
+}
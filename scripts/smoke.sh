@@ -0,0 +1,27 @@
+#!/bin/sh
+# runs the whole chat flow (session setup, text answer, multiply tool round trip) against the mock server, no API key needed
+set -eu
+
+cd "$(dirname "$0")/.."
+bin=$(mktemp -d)/realtime-cli
+go build -o "$bin" .
+
+addr=127.0.0.1:${MOCK_PORT:-8089}
+"$bin" mock-server -addr "$addr" >/dev/null &
+mock=$!
+trap 'kill $mock 2>/dev/null' EXIT
+sleep 1
+
+out=$(printf 'hello there\nplease multiply 6 and 7\n' |
+	OPENAI_API_KEY=mock REALTIME_CLI_URL="ws://$addr/v1/realtime" REALTIME_CLI_CONTAINER=1 REALTIME_CLI_HEALTH_ADDR= REALTIME_CLI_CONFIG=/dev/null \
+	"$bin" 2>/dev/null)
+
+fail() {
+	echo "smoke test failed: $1" >&2
+	echo "$out" >&2
+	exit 1
+}
+echo "$out" | grep -q '"text":"You said: hello there"' || fail "no text answer"
+echo "$out" | grep -q '"name":"multiply","arguments":"{\\"a\\":6,\\"b\\":7}","output":"{\\"result\\": 42}"' || fail "no multiply round trip"
+echo "$out" | grep -q '"text":"You said: tool output {\\"result\\": 42}"' || fail "no follow-up answer with the tool output"
+echo "smoke test passed"
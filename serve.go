@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------------- SERVE (HTTP/SSE bridge, subcommand) --------------------------
+
+// POST /v1/messages with {"message": "..."} runs one turn on the shared session and streams the answer back as
+// Server-Sent Events: "delta" events with the text as it arrives, a "tool" event per tool call, then "done" (or "error")
+const maxServeMessageBytes = 1 << 20
+
+// runServe bridges plain HTTP to a single realtime session, turns are run one at a time in the order they arrive
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8090", "address to listen on (anyone who can reach it uses your API key)")
+	fs.Parse(args)
+
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return err
+	}
+	if requestedProtocol, err = loadProtocol(); err != nil {
+		return err
+	}
+	readLimit, err := loadReadLimit()
+	if err != nil {
+		return err
+	}
+	limits = newToolLimits()
+	if err = applyRegion(keys.pick().secret, readLimit); err != nil {
+		return err
+	}
+
+	sess, err := openSession(keys, config.model, readLimit)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	b := &sseBridge{sess: sess, language: loadSessionLanguage()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/messages", b.handleMessage)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving the realtime session on http://%s/v1/messages\n", ln.Addr())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return srv.Serve(ln)
+}
+
+type sseBridge struct {
+	mu       sync.Mutex //the session streams one response at a time
+	sess     *realtimeSession
+	language string
+}
+
+func (b *sseBridge) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxServeMessageBytes)).Decode(&req); err != nil {
+		http.Error(w, "the body must be JSON like {\"message\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+	input := strings.TrimSpace(req.Message)
+	if input == "" {
+		http.Error(w, "message is empty", http.StatusBadRequest)
+		return
+	}
+	sse, ok := newSSEWriter(w)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats.recordTurn()
+
+	// a client that goes away cancels its response, like Ctrl+C in the chat
+	done, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-r.Context().Done():
+			select {
+			case b.sess.interrupts <- os.Interrupt:
+			default:
+			}
+		case <-done:
+		}
+	}()
+	answer, used, err := b.sess.runTurn(input, instructionsForInput(config.instructions, b.language, input), sse)
+	close(done)
+	<-watched //a disconnect right at the end must not cancel the next request
+	b.sess.releaseInterrupts()
+
+	switch {
+	case errors.Is(err, errResponseCancelled):
+		slog.Info("serve: client went away, response cancelled")
+	case err != nil:
+		slog.Error("serve: turn failed", "err", err)
+		sse.send("error", map[string]string{"error": err.Error()})
+	default:
+		for _, u := range used {
+			sse.send("tool", u)
+		}
+		sse.send("done", map[string]string{"text": answer})
+	}
+
+	if err = b.sess.checkReader(); err != nil {
+		slog.Error("serve: session reader", "err", err)
+	}
+}
+
+// sseWriter is the OutputSink of a request, every piece of the answer is a "delta" event
+type sseWriter struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	return &sseWriter{w: w, f: f}, true
+}
+
+func (s *sseWriter) StartMessage() {}
+
+func (s *sseWriter) Delta(text string) { s.send("delta", map[string]string{"text": text}) } //a client that went away cancels the response
+
+func (s *sseWriter) EndMessage() {}
+
+func (s *sseWriter) Cancelled() {}
+
+func (s *sseWriter) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.f.Flush()
+	return nil
+}
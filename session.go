@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- SESSION (connection + reconnect) --------------------------
+
+const (
+	reconnectAttempts   = 6
+	reconnectBaseDelay  = time.Second
+	reconnectMaxDelay   = 30 * time.Second
+	maxTurnRetries      = 2 //how many times a turn that died with the connection is replayed on a fresh one
+	connectionCheckWait = 5 * time.Second
+	maxToolRounds       = 5 //follow-up responses per turn, a model that keeps calling tools would otherwise never finish the turn
+)
+
+// realtimeSession owns the websocket and its reader goroutine. the server forgets everything when the socket drops,
+// so the finished turns are kept here and replayed into the new connection on reconnect
+type realtimeSession struct {
+	keys      *apiKeyPool
+	key       *pooledKey //the key of the current connection
+	model     string
+	readLimit int64
+
+	conn          *realtimeConn
+	eventsCh      <-chan map[string]any
+	errsCh        <-chan error
+	cancelSession context.CancelFunc
+	interrupts    chan os.Signal //cancels the running response, see catchInterrupts
+
+	tools   *ToolRegistry
+	caps    sessionCapabilities //what the server said about the current connection
+	history []events.Item       //user and assistant messages of the finished turns, in order
+}
+
+func openSession(keys *apiKeyPool, model string, readLimit int64) (*realtimeSession, error) {
+	s := &realtimeSession{keys: keys, model: model, readLimit: readLimit, tools: defaultTools(), interrupts: newInterrupts()}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect dials (moving on to the next key when one is rejected), starts the reader, registers the tools and replays the history
+func (s *realtimeSession) connect() error {
+	key := s.keys.pick()
+	var conn *realtimeConn
+	for {
+		dialCtx, cancelDial := opContext("dial", 30*time.Second)
+		var err error
+		conn, err = dialRealtime(dialCtx, key.secret, s.model, s.readLimit)
+		cancelDial()
+		if err == nil {
+			break
+		}
+		if !s.keys.failover(key, err) {
+			return fmt.Errorf("dial failed: %w", err)
+		}
+		key = s.keys.pick()
+	}
+	s.key = key
+	s.keys.recordConnection(key)
+
+	// start a single reader goroutine for the whole connection
+	sessionCtx, cancelSession := context.WithCancel(context.Background())
+	s.conn, s.cancelSession = conn, cancelSession
+	s.eventsCh, s.errsCh = startReader(sessionCtx, conn)
+
+	// the first server event tells us which protocol variant we actually got
+	createdCtx, cancelCreated := opContext("wait for session", 10*time.Second)
+	sessionCreated, err := waitForOptionalEvent(createdCtx, s.eventsCh, "session.created")
+	cancelCreated()
+	if err != nil {
+		return sessionError(s.errsCh, err)
+	}
+	if sessionCreated != nil { //a gateway that skips it keeps the configured variant
+		conn.protocol = detectProtocol(sessionCreated)
+	}
+	s.caps = detectCapabilities(sessionCreated, conn.protocol)
+	slog.Debug("session created", "model", s.model, "capabilities", s.caps)
+
+	// register the function tools (none when the model cant call them)
+	tools := s.tools
+	if !s.caps.Tools {
+		slog.Warn("the model does not support function calling, no tools are registered", "model", s.model)
+		tools = NewToolRegistry()
+	}
+	updCtx, cancelUpd := opContext("session update", 10*time.Second)
+	err = registerTools(updCtx, conn, tools)
+	cancelUpd()
+	if err != nil {
+		return fmt.Errorf("failed to register tools: %w", sessionError(s.errsCh, err))
+	}
+
+	if err = s.sendItems(s.history); err != nil {
+		return fmt.Errorf("replaying the conversation: %w", err)
+	}
+	return nil
+}
+
+// importHistory adds earlier turns to the conversation, they are kept in the history like the turns of this session
+func (s *realtimeSession) importHistory(items []events.Item) error {
+	if err := s.sendItems(items); err != nil {
+		return err
+	}
+	s.history = append(s.history, items...)
+	return nil
+}
+
+func (s *realtimeSession) sendItems(items []events.Item) error {
+	for _, item := range items {
+		msg, err := events.NewConversationItemCreate(item)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := opContext("send conversation item", 10*time.Second)
+		if err = marshalAndSend(ctx, s.conn, msg); err == nil {
+			_, err = waitForOptionalEvent(ctx, s.eventsCh, "conversation.item.created")
+		}
+		cancel()
+		if err != nil {
+			return sessionError(s.errsCh, err)
+		}
+	}
+	return nil
+}
+
+// reconnect throws the dead connection away and dials again with jittered exponential backoff
+func (s *realtimeSession) reconnect() error {
+	s.close()
+	stats.recordReconnect()
+
+	delay := reconnectBaseDelay
+	var err error
+	for attempt := 1; attempt <= reconnectAttempts; attempt++ {
+		wait := delay/2 + rand.N(delay/2+1)
+		fmt.Printf("Connection lost, reconnecting in %s (attempt %d/%d)...\n", wait.Round(100*time.Millisecond), attempt, reconnectAttempts)
+		time.Sleep(wait)
+
+		if err = s.connect(); err == nil {
+			fmt.Printf("Reconnected, restored %d conversation items.\n", len(s.history))
+			slog.Info("reconnected", "attempt", attempt, "items", len(s.history))
+			return nil
+		}
+		slog.Warn("reconnect attempt failed", "attempt", attempt, "err", err)
+		s.close()
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+	return fmt.Errorf("giving up after %d reconnect attempts: %w", reconnectAttempts, err)
+}
+
+// alive pings the server, a failed turn on a live connection is a real error and must not be replayed
+func (s *realtimeSession) alive() bool {
+	if s.conn == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionCheckWait)
+	defer cancel()
+	return s.conn.Ping(ctx) == nil
+}
+
+// Capabilities reports what the current connection supports, callers use it to turn off features the model doesnt have
+func (s *realtimeSession) Capabilities() sessionCapabilities {
+	return s.caps
+}
+
+func (s *realtimeSession) close() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close(websocket.StatusNormalClosure, "") //before cancelling the reader, a cancelled read tears the connection down without a close frame
+	s.cancelSession()
+	s.conn = nil
+}
+
+// runTurn sends one user input, streams the answer (and the follow-up answer when a tool was called) and
+// records the finished turn in the history. if the connection dies in the middle, it reconnects and replays the turn
+// the tools the model used for the answer are returned with it
+func (s *realtimeSession) runTurn(input, instructions string, out OutputSink) (string, []toolUse, error) {
+	for retry := 0; ; retry++ {
+		answer, used, err := s.turn(input, instructions, out)
+		if err == nil {
+			s.keys.recordTurn(s.key)
+			s.history = append(s.history, events.UserText(input), events.AssistantText(answer))
+			return answer, used, nil
+		}
+		if errors.Is(err, errResponseCancelled) { //the server keeps what was generated before the cancel, so does the history
+			s.history = append(s.history, events.UserText(input))
+			if answer != "" {
+				s.history = append(s.history, events.AssistantText(answer))
+			}
+			return answer, used, err
+		}
+		if retry < maxTurnRetries && s.keys.failover(s.key, err) { //rejected or out of quota in the middle of the session
+			fmt.Println("\nNote: the API key was rejected, retrying with the next one.")
+			s.close()
+			if err = s.connect(); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		if retry == maxTurnRetries || s.alive() {
+			return "", nil, err
+		}
+		fmt.Println()
+		if err = s.reconnect(); err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+func (s *realtimeSession) turn(input, instructions string, out OutputSink) (string, []toolUse, error) {
+	// send the user input to create a new conversation item
+	sendCtx, cancelSend := opContext("send user input", 30*time.Second)
+	itemsSent, err := sendUserInput(sendCtx, s.conn, input)
+	cancelSend()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to send user input: %w", sessionError(s.errsCh, err))
+	}
+
+	// make sure that all the conversation items were created
+	waitCtx, cancelWait := opContext("wait for conversation item", 30*time.Second)
+	for range itemsSent {
+		if _, err = waitForOptionalEvent(waitCtx, s.eventsCh, "conversation.item.created"); err != nil {
+			cancelWait()
+			return "", nil, sessionError(s.errsCh, err)
+		}
+	}
+	cancelWait()
+
+	// generate the response, then run the tools it asked for and let the model answer with their outputs
+	answer, calls, err := s.respond("response", instructions, out)
+	if err != nil {
+		return answer, nil, err
+	}
+	var used []toolUse
+	for round := 1; len(calls) > 0; round++ {
+		if round > maxToolRounds {
+			return "", nil, fmt.Errorf("the model kept calling tools after %d follow-up responses", maxToolRounds)
+		}
+		results, err := runFunctionCalls(s.conn, s.tools, calls)
+		if err != nil {
+			return "", nil, sessionError(s.errsCh, err)
+		}
+		used = append(used, results...)
+		stats.recordFollowUp()
+		if answer, calls, err = s.respond("tool follow-up response", instructions, out); err != nil {
+			return answer, used, err
+		}
+	}
+	return answer, used, nil
+}
+
+// respond asks for one response and streams it
+func (s *realtimeSession) respond(op, instructions string, out OutputSink) (string, []functionCall, error) {
+	reqCtx, cancelReq := opContext("request "+op, 30*time.Second)
+	err := requestTextResponse(reqCtx, s.conn, instructions)
+	cancelReq()
+	if err != nil {
+		return "", nil, sessionError(s.errsCh, err)
+	}
+
+	usage.use(s.model)
+	streamCtx, cancelStream := opContext("stream "+op, config.timeout)
+	answer, calls, err := streamAssistantTextFromChan(streamCtx, s.conn, s.eventsCh, s.interrupts, out)
+	cancelStream()
+	if errors.Is(err, errResponseCancelled) {
+		return answer, nil, err
+	}
+	if err != nil {
+		return "", nil, sessionError(s.errsCh, err)
+	}
+	return answer, calls, nil
+}
+
+// checkReader takes care of reader errors that happened between turns: a dead connection is reconnected, anything else is returned
+func (s *realtimeSession) checkReader() error {
+	select {
+	case err, ok := <-s.errsCh:
+		if ok && err == nil {
+			return nil
+		}
+		if ok && s.alive() {
+			return fmt.Errorf("reader error: %w", err)
+		}
+		return s.reconnect()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kerenschoss369/go-home-assignment/mockrealtime"
+)
+
+// startMockServer starts the mock realtime server and points the client at it
+func startMockServer(t *testing.T) *apiKeyPool {
+	t.Helper()
+	srv := httptest.NewServer(mockrealtime.Handler())
+	t.Cleanup(srv.Close)
+	t.Setenv("OPENAI_API_KEY", "mock")
+	t.Setenv(apiKeysEnvVar, "")
+	url := config.url
+	config.url = "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/realtime"
+	t.Cleanup(func() { config.url = url })
+
+	keys, err := loadAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// openMockSession opens a chat session on the mock realtime server
+func openMockSession(t *testing.T) *realtimeSession {
+	t.Helper()
+	sess, err := openSession(startMockServer(t), config.model, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sess.close)
+	return sess
+}
+
+func TestSessionTextTurn(t *testing.T) {
+	sess := openMockSession(t)
+	out := &recordingSink{}
+	answer, used, err := sess.runTurn("hello there", config.instructions, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "You said: hello there" {
+		t.Errorf("answer = %q", answer)
+	}
+	if len(used) != 0 {
+		t.Errorf("no tool should be called, got %+v", used)
+	}
+	if want := []string{"start", "delta:You said: hello there", "end"}; !slices.Equal(out.calls, want) {
+		t.Errorf("the answer was not streamed to the sink: got %q, want %q", out.calls, want)
+	}
+}
+
+func TestSessionToolRoundTrip(t *testing.T) {
+	sess := openMockSession(t)
+	answer, used, err := sess.runTurn("please multiply 6 and 7", config.instructions, discardSink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 1 {
+		t.Fatalf("want one tool call, got %+v", used)
+	}
+	if used[0].Name != "multiply" || used[0].Args != `{"a":6,"b":7}` {
+		t.Errorf("tool call = %s(%s), want multiply({\"a\":6,\"b\":7})", used[0].Name, used[0].Args)
+	}
+	if used[0].Output != `{"result": 42}` {
+		t.Errorf("tool output = %s", used[0].Output)
+	}
+	if answer != `You said: tool output {"result": 42}` {
+		t.Errorf("the follow-up answer should carry the tool output, got %q", answer)
+	}
+	if len(sess.history) != 2 {
+		t.Errorf("the turn should be kept in the history, got %d items", len(sess.history))
+	}
+}
+
+func TestToolLimitsPerSession(t *testing.T) {
+	keys := startMockServer(t)
+	perSession := config.maxToolCallsPerSession
+	config.maxToolCallsPerSession = 1
+	t.Cleanup(func() { config.maxToolCallsPerSession, limits = perSession, nil })
+
+	m := NewSessionManager(keys, config.model, 1<<20)
+	t.Cleanup(m.closeAll)
+	refused := func() bool { return limits.admit(0) != "" }
+
+	if _, err := m.open(); err != nil {
+		t.Fatal(err)
+	}
+	if refused() || !refused() {
+		t.Fatal("session 1 should allow exactly one tool call")
+	}
+	if _, err := m.open(); err != nil { //like /new
+		t.Fatal(err)
+	}
+	if refused() {
+		t.Error("a new session should start with its own count")
+	}
+	if err := m.switchTo(1); err != nil {
+		t.Fatal(err)
+	}
+	if !refused() {
+		t.Error("switching back should keep the count of session 1")
+	}
+	if err := m.reset(); err != nil { //like /clear
+		t.Fatal(err)
+	}
+	if refused() {
+		t.Error("a cleared session should start counting again")
+	}
+}
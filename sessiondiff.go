@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// -------------------------- TRANSCRIPT DIFF (diff subcommand) --------------------------
+
+// checkpointTurn is a user input with the answer it got, the unit two runs are compared by
+type checkpointTurn struct {
+	input, answer string
+	tools         []string
+}
+
+// runDiff compares two transcripts saved with /save, e.g. the same prompts before and after an instructions change.
+// the turns are aligned by their input, so a prompt added or dropped in one run doesn't shift the rest
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	changedOnly := fs.Bool("changed", false, "only show the turns whose answers differ")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] <a.json> <b.json>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("give exactly two JSON transcripts")
+	}
+	a, err := loadConversationLog(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadConversationLog(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("A: %s (%s, %d turns)\nB: %s (%s, %d turns)\n", fs.Arg(0), a.Model, len(checkpointTurns(a)), fs.Arg(1), b.Model, len(checkpointTurns(b)))
+	fmt.Print(diffCheckpoints(checkpointTurns(a), checkpointTurns(b), *changedOnly))
+	return nil
+}
+
+// checkpointTurns pairs every user entry with the assistant entry after it, a turn without an answer has an empty one
+func checkpointTurns(l *conversationLog) []checkpointTurn {
+	var turns []checkpointTurn
+	for _, e := range l.Entries {
+		switch {
+		case e.Role == "user":
+			turns = append(turns, checkpointTurn{input: e.Text})
+		case e.Role == "assistant" && len(turns) > 0 && turns[len(turns)-1].answer == "":
+			t := &turns[len(turns)-1]
+			t.answer = e.Text
+			for _, u := range e.Tools {
+				t.tools = append(t.tools, u.Name)
+			}
+		}
+	}
+	return turns
+}
+
+// alignTurns matches the turns of both runs by input (longest common subsequence), unmatched turns pair with -1.
+// runs too long for the LCS are paired turn by turn
+func alignTurns(a, b []checkpointTurn) [][2]int {
+	keys := func(turns []checkpointTurn) []string {
+		k := make([]string, len(turns))
+		for i, t := range turns {
+			k[i] = strings.ToLower(strings.Join(strings.Fields(t.input), " "))
+		}
+		return k
+	}
+	if pairs, ok := lcsPairs(keys(a), keys(b)); ok {
+		return pairs
+	}
+	pairs := make([][2]int, max(len(a), len(b)))
+	for n := range pairs {
+		pairs[n] = [2]int{n, n}
+		if n >= len(a) {
+			pairs[n][0] = -1
+		}
+		if n >= len(b) {
+			pairs[n][1] = -1
+		}
+	}
+	return pairs
+}
+
+// diffCheckpoints renders the aligned turns: the answer diff of the changed ones and the turns only one run has
+func diffCheckpoints(a, b []checkpointTurn, changedOnly bool) string {
+	var out strings.Builder
+	var same, changed, onlyA, onlyB int
+	for n, p := range alignTurns(a, b) {
+		switch {
+		case p[1] < 0:
+			onlyA++
+			fmt.Fprintf(&out, "\n#%d only in A: %q\n  %s\n", n+1, shorten(a[p[0]].input), a[p[0]].answer)
+		case p[0] < 0:
+			onlyB++
+			fmt.Fprintf(&out, "\n#%d only in B: %q\n  %s\n", n+1, shorten(b[p[1]].input), b[p[1]].answer)
+		default:
+			ta, tb := a[p[0]], b[p[1]]
+			if ta.answer == tb.answer && slices.Equal(ta.tools, tb.tools) {
+				same++
+				if !changedOnly {
+					fmt.Fprintf(&out, "\n#%d same: %q\n", n+1, shorten(ta.input))
+				}
+				continue
+			}
+			changed++
+			fmt.Fprintf(&out, "\n#%d changed: %q\n  %s\n", n+1, shorten(ta.input), wordDiff(ta.answer, tb.answer))
+			if !slices.Equal(ta.tools, tb.tools) {
+				fmt.Fprintf(&out, "  tools: A %s, B %s\n", toolList(ta.tools), toolList(tb.tools))
+			}
+		}
+	}
+	fmt.Fprintf(&out, "\n%d same, %d changed, %d only in A, %d only in B\n", same, changed, onlyA, onlyB)
+	return out.String()
+}
+
+func toolList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// -------------------------- SESSIONS (/new, /switch, /list) --------------------------
+
+const (
+	newSessionCommand    = "/new"
+	switchSessionCommand = "/switch"
+	listSessionsCommand  = "/list"
+)
+
+// chatSession is one conversation of the process: its own connection (and reader goroutine), tools, history and transcript
+type chatSession struct {
+	id         int
+	sess       *realtimeSession
+	transcript *conversationLog
+	lastInput  string       //what /escalate asks again
+	lastAnswer string       //what /revise works on
+	router     *modelRouter //nil unless -cheap-model is set, then sess is the cheap model's connection
+	limits     *toolLimits  //the tool calls and fetched bytes of this conversation, the global limits while it is current
+	opened     time.Time
+}
+
+// runTurn sends the input to the model of the conversation, through the router when there is one
+func (cs *chatSession) runTurn(input, instructions string, out OutputSink, escalate bool) (string, []toolUse, error) {
+	switch {
+	case cs.router == nil:
+		return cs.sess.runTurn(input, instructions, out)
+	case escalate:
+		return cs.router.escalate(cs.sess, input, instructions, out)
+	default:
+		return cs.router.runTurn(cs.sess, input, instructions, out)
+	}
+}
+
+// SessionManager holds every conversation opened with /new, only the current one gets the user input.
+// the others stay connected and keep their history, a dropped connection is reconnected when it is switched to
+type SessionManager struct {
+	keys      *apiKeyPool
+	model     string
+	readLimit int64
+
+	sessions []*chatSession
+	current  *chatSession
+	nextID   int
+}
+
+func NewSessionManager(keys *apiKeyPool, model string, readLimit int64) *SessionManager {
+	return &SessionManager{keys: keys, model: model, readLimit: readLimit, nextID: 1}
+}
+
+// open starts a new conversation and makes it the current one
+func (m *SessionManager) open() (*chatSession, error) {
+	model := m.model
+	if config.cheapModel != "" {
+		model = config.cheapModel
+	}
+	sess, err := openSession(m.keys, model, m.readLimit)
+	if err != nil {
+		return nil, err
+	}
+	cs := &chatSession{id: m.nextID, sess: sess, transcript: newConversationLog(m.model), limits: newToolLimits(), opened: time.Now()}
+	if config.cheapModel != "" {
+		cs.router = newModelRouter(m.keys, config.cheapModel, m.model, m.readLimit)
+	}
+	m.nextID++
+	m.sessions = append(m.sessions, cs)
+	m.current, limits = cs, cs.limits
+	return cs, nil
+}
+
+// reset replaces the current conversation with a new one and closes the old one, nothing of it is kept (kiosk idle clear)
+func (m *SessionManager) reset() error {
+	old := m.current
+	if _, err := m.open(); err != nil {
+		return err
+	}
+	old.sess.close()
+	if old.router != nil {
+		old.router.close()
+	}
+	m.sessions = slices.DeleteFunc(m.sessions, func(cs *chatSession) bool { return cs == old })
+	return nil
+}
+
+// switchTo makes the conversation with this id the current one
+func (m *SessionManager) switchTo(id int) error {
+	for _, cs := range m.sessions {
+		if cs.id != id {
+			continue
+		}
+		if err := cs.sess.checkReader(); err != nil { //it may have dropped while it was in the background
+			return err
+		}
+		m.current, limits = cs, cs.limits
+		return nil
+	}
+	return fmt.Errorf("there is no session %d, /list shows the open ones", id)
+}
+
+func (m *SessionManager) list() string {
+	var b strings.Builder
+	for _, cs := range m.sessions {
+		marker := " "
+		if cs == m.current {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %d  opened %s, %d turns", marker, cs.id, cs.opened.Format("15:04:05"), len(cs.transcript.Entries)/2)
+		if first := firstUserText(cs.transcript); first != "" {
+			fmt.Fprintf(&b, ", %q", shorten(first))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func firstUserText(l *conversationLog) string {
+	for _, e := range l.Entries {
+		if e.Role == "user" {
+			return e.Text
+		}
+	}
+	return ""
+}
+
+func (m *SessionManager) closeAll() {
+	for _, cs := range m.sessions {
+		cs.sess.close()
+		if cs.router != nil {
+			cs.router.close()
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// -------------------------- TIME-BOXED SESSION (-max-session) --------------------------
+
+// the model is asked for this when the time is up, the answer is written to the wrap-up file
+const wrapUpPrompt = "The session time is up. Write a short wrap-up summary of this conversation: what was asked, the answers " +
+	"and anything left open. Do not call any tools."
+
+var errSessionOver = errors.New("the session time is up")
+
+// sessionClock ends the chat after -max-session, with a note -max-session-warn before. a nil clock never ends
+type sessionClock struct {
+	limit, warnBefore time.Duration
+	started           time.Time
+	warn, end         chan struct{} //closed when the time comes, so they stay ready for every later select
+	warned            bool
+}
+
+func newSessionClock(limit, warnBefore time.Duration) *sessionClock {
+	if limit <= 0 {
+		return nil
+	}
+	c := &sessionClock{limit: limit, warnBefore: warnBefore, started: time.Now(), warn: make(chan struct{}), end: make(chan struct{})}
+	warn, end := c.warn, c.end
+	if warnBefore > 0 && warnBefore < limit {
+		time.AfterFunc(limit-warnBefore, func() { close(warn) })
+	}
+	time.AfterFunc(limit, func() { close(end) })
+	return c
+}
+
+// over reports whether the time is up, without waiting
+func (c *sessionClock) over() bool {
+	if c == nil {
+		return false
+	}
+	select {
+	case <-c.end:
+		return true
+	default:
+		return false
+	}
+}
+
+// warnC is closed when the warning is due and until it was shown, endC when the time is up (nil channels never fire)
+func (c *sessionClock) warnC() <-chan struct{} {
+	if c == nil || c.warned {
+		return nil
+	}
+	return c.warn
+}
+
+func (c *sessionClock) endC() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	return c.end
+}
+
+// showWarning prints how much time is left, once
+func (c *sessionClock) showWarning(prompt string) {
+	c.warned = true
+	left := c.limit - time.Since(c.started)
+	fmt.Printf("\nNote: %s left in this session, then it ends with a wrap-up summary.\n%s", left.Round(time.Second), prompt)
+}
+
+// wrapUp asks the current conversation for its summary and writes it to path (a timestamped file when empty)
+func wrapUp(cs *chatSession, path string, c *sessionClock) error {
+	fmt.Println("The session time is up, asking for a wrap-up summary.")
+	summary, _, err := cs.runTurn(wrapUpPrompt, config.instructions, newTerminalSink(os.Stdout), false)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = "wrap-up-" + time.Now().Format("20060102-150405") + ".md"
+	}
+	content := fmt.Sprintf("# Session wrap-up\n\n%s, %d turns in %s with %s.\n\n%s\n",
+		c.started.Format("2006-01-02 15:04"), len(cs.transcript.Entries)/2, time.Since(c.started).Round(time.Second), config.model, summary)
+	if err = os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("\nWrap-up saved to %s.\n", path)
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// -------------------------- run_command TOOL (opt-in) --------------------------
+
+// the tool only exists with -enable-shell-tool, and only runs programs named in the allowlist. the command line is split
+// into arguments and run directly, never through a shell, so pipes, redirections and chaining can't smuggle in other programs.
+// the programs run in the sandbox directory (the working directory without -sandbox) with a minimal environment, the API
+// keys and the rest of the user's variables are not theirs to read
+const (
+	shellAllowlistEnvVar = "REALTIME_CLI_SHELL_ALLOWLIST"
+	shellOutputMax       = 16 << 10 //of stdout and of stderr, the rest is cut
+)
+
+// the default reads no files: a cat or a grep could read any file of the user, they have to be allowed on purpose
+var defaultShellAllowlist = []string{"ls", "pwd", "date", "whoami", "uname", "echo"}
+
+// shellEnvKeys are the only variables passed on to the programs, what they need to find each other and to format their output
+var shellEnvKeys = []string{"PATH", "HOME", "LANG", "LC_ALL", "TZ", "SYSTEMROOT"}
+
+// parseShellAllowlist reads the comma separated program names of -shell-allowlist, shell_allowlist or the env var
+func parseShellAllowlist(raw string) ([]string, error) {
+	var allow []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allow = append(allow, name)
+		}
+	}
+	if len(allow) == 0 {
+		return nil, errors.New("the shell allowlist needs at least one program")
+	}
+	return allow, nil
+}
+
+func shellEnv() []string {
+	var env []string
+	for _, key := range shellEnvKeys {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
+
+// runCommandTool runs the allowed programs in dir, an empty dir is the working directory
+func runCommandTool(allow []string, dir string) Tool {
+	return Tool{
+		Name: "run_command",
+		Description: "Run a program on the user's machine and return its exit code, stdout and stderr. Allowed programs: " +
+			strings.Join(allow, ", ") + ". Arguments can be quoted; pipes, redirections and chaining are not supported.",
+		JSONSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string", "description": "the command line, e.g. ls -la docs"},
+			},
+			"required": []string{"command"},
+		},
+		Handler: func(ctx context.Context, argsJSON string) (string, error) {
+			var args struct {
+				Command string `json:"command"`
+			}
+			if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+				return "", fmt.Errorf("bad run_command args: %w", err)
+			}
+			result, err := runAllowedCommand(ctx, allow, dir, args.Command)
+			if err != nil {
+				result = map[string]any{"error": err.Error()}
+			}
+			out, err := json.Marshal(result)
+			if err != nil {
+				return "", err
+			}
+			return string(out), nil
+		},
+	}
+}
+
+// runAllowedCommand runs the command when its program is allowed, a non zero exit is a result and not an error
+func runAllowedCommand(ctx context.Context, allow []string, dir, command string) (map[string]any, error) {
+	argv, err := splitCommandLine(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("the command is empty")
+	}
+	if !slices.Contains(allow, argv[0]) {
+		return nil, fmt.Errorf("%q is not an allowed program (allowed: %s)", argv[0], strings.Join(allow, ", "))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir, cmd.Env = dir, shellEnv()
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && ctx.Err() == nil:
+		exitCode = exitErr.ExitCode()
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("the command did not finish in time: %w", ctx.Err())
+	case err != nil:
+		return nil, err
+	}
+	return map[string]any{
+		"exit_code": exitCode,
+		"stdout":    truncateOutput(stdout.String()),
+		"stderr":    truncateOutput(stderr.String()),
+	}, nil
+}
+
+func truncateOutput(s string) string {
+	if len(s) <= shellOutputMax {
+		return s
+	}
+	return s[:shellOutputMax] + fmt.Sprintf("\n[cut, %d more bytes]", len(s)-shellOutputMax)
+}
+
+// splitCommandLine splits on spaces with single and double quotes and backslash escapes (outside single quotes),
+// shell operators are refused rather than passed on as arguments the model didnt mean
+func splitCommandLine(s string) ([]string, error) {
+	var argv []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				argv = append(argv, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case strings.ContainsRune("|;&<>`$()", r):
+			return nil, fmt.Errorf("%q is a shell operator, run one program at a time without pipes or redirections", r)
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape in the command")
+	}
+	if inArg {
+		argv = append(argv, cur.String())
+	}
+	return argv, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"ls -la docs", []string{"ls", "-la", "docs"}},
+		{"  ls \t -la\n", []string{"ls", "-la"}},
+		{"", nil},
+		{`echo "a b" 'c d'`, []string{"echo", "a b", "c d"}},
+		{`echo "it's"`, []string{"echo", "it's"}},
+		{`echo 'say "hi"'`, []string{"echo", `say "hi"`}},
+		{`echo a"b c"d`, []string{"echo", "ab cd"}},
+		{`echo "" ''`, []string{"echo", "", ""}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo \"x\"`, []string{"echo", `"x"`}},
+		{`echo "a\"b"`, []string{"echo", `a"b`}},
+		{`echo 'a\b'`, []string{"echo", `a\b`}}, //no escapes in single quotes
+		{`echo \|`, []string{"echo", "|"}},
+		{`echo "a | b; c"`, []string{"echo", "a | b; c"}}, //operators are plain text in quotes
+		{`echo 'x > y'`, []string{"echo", "x > y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := splitCommandLine(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCommandLineErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string //a substring of the error
+	}{
+		{"ls | grep x", `'|' is a shell operator`},
+		{"ls; rm x", `';' is a shell operator`},
+		{"ls && rm x", `'&' is a shell operator`},
+		{"ls & ", `'&' is a shell operator`},
+		{"ls < in", `'<' is a shell operator`},
+		{"ls > out", `'>' is a shell operator`},
+		{"echo `id`", "'`' is a shell operator"},
+		{"echo $HOME", `'$' is a shell operator`},
+		{"echo $(id)", `'$' is a shell operator`},
+		{"echo (x)", `'(' is a shell operator`},
+		{"echo x)", `')' is a shell operator`},
+		{`echo "open`, "unterminated"},
+		{`echo 'open`, "unterminated"},
+		{`echo x\`, "unterminated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			argv, err := splitCommandLine(tt.line)
+			if err == nil {
+				t.Fatalf("want an error, got %q", argv)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunAllowedCommand(t *testing.T) {
+	for _, program := range []string{"pwd", "env"} {
+		if _, err := exec.LookPath(program); err != nil {
+			t.Skip(program, "is not installed")
+		}
+	}
+	dir := t.TempDir()
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	allow := []string{"pwd", "env"}
+
+	result, err := runAllowedCommand(context.Background(), allow, dir, "pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := filepath.EvalSymlinks(strings.TrimSpace(result["stdout"].(string)))
+	want, _ := filepath.EvalSymlinks(dir)
+	if got != want {
+		t.Errorf("ran in %s, want the sandbox %s", got, want)
+	}
+
+	result, err = runAllowedCommand(context.Background(), allow, dir, "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env := result["stdout"].(string); strings.Contains(env, "sk-secret") || !strings.Contains(env, "PATH=") {
+		t.Errorf("the environment should only have the minimal variables, got:\n%s", env)
+	}
+
+	if _, err := runAllowedCommand(context.Background(), allow, dir, "cat /etc/passwd"); err == nil || !strings.Contains(err.Error(), "not an allowed program") {
+		t.Errorf("cat should not be allowed, got %v", err)
+	}
+}
+
+func TestParseShellAllowlist(t *testing.T) {
+	got, err := parseShellAllowlist(" ls, ,git ,")
+	if err != nil || !slices.Equal(got, []string{"ls", "git"}) {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := parseShellAllowlist(" , "); err == nil {
+		t.Error("an empty allowlist should be refused")
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !noaudio
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+)
+
+// -------------------------- AUDIO OUTPUT --------------------------
+
+const (
+	// set to 1 to have the answers spoken (the text is still printed from the audio transcript)
+	audioOutputEnvVar = "REALTIME_CLI_AUDIO"
+	playerEnvVar      = "REALTIME_CLI_PLAYER"
+	// audio chunks waiting for the player, the stream loop must never wait for playback (it runs in real time, the stream doesnt)
+	playerQueueSize = 4096
+)
+
+// audioPlayer pipes the response audio into an external player process
+type audioPlayer struct {
+	cmd   *exec.Cmd
+	queue chan []byte
+	done  chan struct{}
+}
+
+// speaker is nil when audio output is off, all the methods below are safe to call on a nil *audioPlayer
+var speaker *audioPlayer
+
+// loadSpeaker starts the player when audio output was asked for
+func loadSpeaker() (*audioPlayer, error) {
+	if os.Getenv(audioOutputEnvVar) != "1" {
+		return nil, nil
+	}
+	command := os.Getenv(playerEnvVar)
+	if command == "" {
+		command = defaultPlayerCommand
+	}
+
+	if !commandAvailable(command) {
+		slog.Warn("audio: player not found, answers will be text only (set the env var to a command that plays raw PCM16 mono 24kHz from stdin)", "player", command, "env", playerEnvVar)
+		return nil, nil
+	}
+
+	cmd := shellCommand(context.Background(), command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting the player %q: %w", command, err)
+	}
+
+	p := &audioPlayer{cmd: cmd, queue: make(chan []byte, playerQueueSize), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		defer stdin.Close()
+		for pcm := range p.queue {
+			if _, err := stdin.Write(pcm); err != nil {
+				slog.Warn("audio: the player stopped, no more audio will be played", "err", err)
+				for range p.queue { //keep draining so play never blocks
+				}
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+// modalities returns the response modalities to ask for (the API only allows text alone or audio with text)
+func (p *audioPlayer) modalities() []string {
+	if p == nil {
+		return []string{events.ModalityText}
+	}
+	return []string{events.ModalityAudio, events.ModalityText}
+}
+
+// play queues one base64 response.audio.delta
+func (p *audioPlayer) play(deltaB64 string) {
+	if p == nil || deltaB64 == "" {
+		return
+	}
+	pcm, err := base64.StdEncoding.DecodeString(deltaB64)
+	if err != nil {
+		slog.Warn("audio: bad audio delta", "err", err)
+		return
+	}
+	select {
+	case p.queue <- pcm:
+	default:
+		slog.Warn("audio: player queue is full, dropping audio", "bytes", len(pcm))
+	}
+}
+
+// close lets the player finish what was queued and waits for it to exit
+func (p *audioPlayer) close() {
+	if p == nil {
+		return
+	}
+	close(p.queue)
+	<-p.done
+	p.cmd.Wait()
+}
+
+// flush drops the audio that is queued but not played yet (what the player already buffered still plays)
+func (p *audioPlayer) flush() {
+	if p == nil {
+		return
+	}
+	for {
+		select {
+		case _, ok := <-p.queue:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build noaudio
+
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+)
+
+// -------------------------- AUDIO OUTPUT (disabled) --------------------------
+
+// built with -tags noaudio: the answers are always text only, the rest of the code doesnt need to know
+
+const audioOutputEnvVar = "REALTIME_CLI_AUDIO"
+
+type audioPlayer struct{}
+
+var speaker *audioPlayer
+
+func loadSpeaker() (*audioPlayer, error) {
+	if os.Getenv(audioOutputEnvVar) == "1" {
+		slog.Warn("audio: this binary was built without audio output (-tags noaudio), the env var is ignored", "env", audioOutputEnvVar)
+	}
+	return nil, nil
+}
+
+func (p *audioPlayer) modalities() []string { return []string{events.ModalityText} }
+
+func (p *audioPlayer) play(string) {}
+
+func (p *audioPlayer) flush() {}
+
+func (p *audioPlayer) close() {}
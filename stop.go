@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// -------------------------- STOP STRINGS (-stop) --------------------------
+
+// stopMatcher cuts the streamed text of a message at the first stop string. a stop string can be split over
+// several deltas, so the end of the text that could still start one is held back until the next delta tells
+type stopMatcher struct {
+	stops   []string
+	longest int
+	held    string
+}
+
+// newStopMatcher returns nil without stop strings, a nil matcher passes the text through
+func newStopMatcher(stops []string) *stopMatcher {
+	if len(stops) == 0 {
+		return nil
+	}
+	m := &stopMatcher{stops: stops}
+	for _, s := range stops {
+		m.longest = max(m.longest, len(s))
+	}
+	return m
+}
+
+// feed returns the text that can be shown and whether a stop string was reached, nothing after it is shown
+func (m *stopMatcher) feed(delta string) (string, bool) {
+	if m == nil {
+		return delta, false
+	}
+	text := m.held + delta
+	cut := -1
+	for _, s := range m.stops {
+		if i := strings.Index(text, s); i >= 0 && (cut < 0 || i < cut) {
+			cut = i
+		}
+	}
+	if cut >= 0 {
+		m.held = ""
+		return text[:cut], true
+	}
+	keep := len(text) - (m.longest - 1)
+	if keep < 0 {
+		keep = 0
+	}
+	for keep > 0 && keep < len(text) && !utf8.RuneStart(text[keep]) { //never split a character
+		keep--
+	}
+	m.held = text[keep:]
+	return text[:keep], false
+}
+
+// flush returns the held back text at the end of a message, the next message starts clean
+func (m *stopMatcher) flush() string {
+	if m == nil {
+		return ""
+	}
+	held := m.held
+	m.held = ""
+	return held
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -------------------------- TELEMETRY --------------------------
+
+// anonymous usage statistics are strictly opt-in: nothing is collected or sent unless this env var holds an endpoint
+const telemetryEnvVar = "REALTIME_CLI_TELEMETRY_URL"
+
+// usageStats holds aggregate counters only (no prompts, no responses, no keys)
+type usageStats struct {
+	endpoint   string
+	started    time.Time
+	turns      atomic.Int64
+	toolCalls  atomic.Int64
+	followUps  atomic.Int64
+	errors     atomic.Int64
+	reconnects atomic.Int64
+
+	mu       sync.Mutex
+	features map[string]int64 //how often each optional feature was used: modes, subcommands, slash commands and tools
+}
+
+// stats is nil when the user didnt opt in, all the methods below are safe to call on a nil *usageStats
+var stats *usageStats
+
+func loadTelemetry() *usageStats {
+	endpoint := os.Getenv(telemetryEnvVar)
+	if endpoint == "" {
+		return nil
+	}
+	return &usageStats{endpoint: endpoint, started: time.Now(), features: map[string]int64{}}
+}
+
+// recordFeature counts one use of a feature, the names are fixed strings of the CLI like "mode:audio" or "command:/save"
+func (s *usageStats) recordFeature(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features[name]++
+}
+
+// recordChatModes counts the optional modes the chat was started with, once per session
+func (s *usageStats) recordChatModes() {
+	modes := map[string]bool{
+		"audio":      speaker != nil,
+		"router":     config.cheapModel != "",
+		"shell_tool": config.shellTool,
+		"sandbox":    config.sandbox != "",
+		"kiosk":      config.kiosk,
+		"time_limit": config.maxSession > 0,
+		"record":     config.record != "",
+		"stop":       len(config.stops) > 0,
+		"extract":    len(config.extractors) > 0,
+		"validate":   config.validate != "",
+		"overlay":    config.overlay != "",
+		"podcast":    podcast != nil,
+		"markdown":   renderMarkdown,
+	}
+	for mode, on := range modes {
+		if on {
+			s.recordFeature("mode:" + mode)
+		}
+	}
+}
+
+func (s *usageStats) recordTurn() {
+	if s != nil {
+		s.turns.Add(1)
+	}
+}
+
+func (s *usageStats) recordToolCall(name string) {
+	if s != nil {
+		s.toolCalls.Add(1)
+		s.recordFeature("tool:" + name)
+	}
+}
+
+func (s *usageStats) recordFollowUp() {
+	if s != nil {
+		s.followUps.Add(1)
+	}
+}
+
+func (s *usageStats) recordReconnect() {
+	if s != nil {
+		s.reconnects.Add(1)
+	}
+}
+
+func (s *usageStats) recordError() {
+	if s != nil {
+		s.errors.Add(1)
+	}
+}
+
+// flush posts the counters once at the end of the session, failures are only logged because telemetry must never break the CLI
+func (s *usageStats) flush() {
+	if s == nil {
+		return
+	}
+	report := map[string]any{
+		"model":            config.model,
+		"session_seconds":  int64(time.Since(s.started).Seconds()),
+		"turns":            s.turns.Load(),
+		"tool_calls":       s.toolCalls.Load(),
+		"follow_responses": s.followUps.Load(),
+		"errors":           s.errors.Load(),
+		"reconnects":       s.reconnects.Load(),
+	}
+	s.mu.Lock()
+	report["features"] = s.features
+	body, err := json.Marshal(report)
+	s.mu.Unlock()
+	if err != nil {
+		slog.Warn("telemetry: marshal error", "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("telemetry: bad endpoint", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Warn("telemetry: sending the report failed", "err", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (s *usageStats) notice() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("Anonymous usage statistics (turn/tool/error and feature counters only) will be sent to %s. Unset %s to disable.\n", s.endpoint, telemetryEnvVar)
+}
+
+// fatalf counts the error and flushes the statistics before exiting, the deferred calls are skipped like with log.Fatal
+func fatalf(format string, args ...any) {
+	stats.recordError()
+	stats.flush()
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+)
+
+// -------------------------- TOOL REGISTRY --------------------------
+
+// Tool is a function the model can call, Handler gets the raw JSON arguments and returns the JSON output sent back to the model.
+// an error (or a handler that runs past its timeout) is sent back as {"error": ...} too, the turn goes on
+type Tool struct {
+	Name        string
+	Description string
+	JSONSchema  map[string]any
+	Handler     func(ctx context.Context, argsJSON string) (string, error)
+	Timeout     time.Duration //0 is -tool-timeout, -tool-timeouts overrides both
+}
+
+// ToolRegistry keeps the tools in registration order, which is also the order they are announced in session.update
+type ToolRegistry struct {
+	order  []string
+	byName map[string]Tool
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{byName: map[string]Tool{}}
+}
+
+func (r *ToolRegistry) Register(t Tool) error {
+	if t.Name == "" {
+		return errors.New("tool without a name")
+	}
+	if t.Handler == nil {
+		return fmt.Errorf("tool %q has no handler", t.Name)
+	}
+	if _, ok := r.byName[t.Name]; ok {
+		return fmt.Errorf("tool %q registered twice", t.Name)
+	}
+	r.order = append(r.order, t.Name)
+	r.byName[t.Name] = t
+	return nil
+}
+
+func (r *ToolRegistry) Lookup(name string) (Tool, bool) {
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+// Definitions returns the tools in the shape session.update expects
+func (r *ToolRegistry) Definitions() []events.Tool {
+	defs := make([]events.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		t := r.byName[name]
+		defs = append(defs, events.FunctionTool(t.Name, t.Description, t.JSONSchema))
+	}
+	return defs
+}
+
+// toolInstructions tell the model when to reach for the tools, a sentence is only used when one of its tools is registered
+var toolInstructions = []struct {
+	tools []string
+	text  string
+}{
+	{[]string{"multiply"}, multipleInstractions},
+	{[]string{"add", "divide", "power", "sqrt", "evaluate"}, mathInstructions},
+	{[]string{"query_csv"}, csvInstructions},
+	{[]string{"fetch_url"}, fetchInstructions},
+}
+
+// Instructions returns what session.update adds to the instructions for the registered tools, empty without tools
+func (r *ToolRegistry) Instructions() string {
+	var b strings.Builder
+	for _, ti := range toolInstructions {
+		if slices.ContainsFunc(ti.tools, func(name string) bool { _, ok := r.byName[name]; return ok }) {
+			b.WriteString(ti.text)
+		}
+	}
+	return b.String()
+}
+
+// Call runs the handler of the named tool
+func (r *ToolRegistry) Call(ctx context.Context, name, argsJSON string) (string, error) {
+	t, ok := r.Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("model called unknown tool %q", name)
+	}
+	return t.Handler(ctx, argsJSON)
+}
+
+// -------------------------- TOOL EXECUTION --------------------------
+
+const (
+	toolTimeoutEnvVar  = "REALTIME_CLI_TOOL_TIMEOUT"  //for every tool, e.g. 10s
+	toolTimeoutsEnvVar = "REALTIME_CLI_TOOL_TIMEOUTS" //per tool, e.g. fetch_url=30s,run_command=5s
+	defaultToolTimeout = 30 * time.Second
+)
+
+// toolTimeouts is how long a handler may run before the model is told it timed out
+type toolTimeouts struct {
+	all    time.Duration //-tool-timeout, 0 when not set
+	byTool map[string]time.Duration
+}
+
+// parseToolTimeout reads tool_timeout of the config file or the environment
+func parseToolTimeout(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration like 10s, got %q", name, value)
+	}
+	return d, nil
+}
+
+// parseToolTimeouts reads the tool=duration pairs of tool_timeouts, e.g. fetch_url=30s,run_command=5s
+func parseToolTimeouts(value string) (map[string]time.Duration, error) {
+	byTool := map[string]time.Duration{}
+	for _, pair := range strings.Split(value, ",") {
+		tool, raw, _ := strings.Cut(pair, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if strings.TrimSpace(tool) == "" || err != nil || d <= 0 {
+			return nil, fmt.Errorf("expected tool=duration like fetch_url=30s, got %q", pair)
+		}
+		byTool[strings.TrimSpace(tool)] = d
+	}
+	return byTool, nil
+}
+
+// of picks the timeout of a tool: its own -tool-timeouts entry, then -tool-timeout, then the tool's default
+func (t toolTimeouts) of(tool Tool) time.Duration {
+	switch {
+	case t.byTool[tool.Name] > 0:
+		return t.byTool[tool.Name]
+	case t.all > 0:
+		return t.all
+	case tool.Timeout > 0:
+		return tool.Timeout
+	}
+	return defaultToolTimeout
+}
+
+// runTool calls the handler and always comes back with an output for the model, even when the handler fails, panics
+// or hangs. the error (also returned) is only for the log. a handler that ignores its context keeps running in the background
+func (r *ToolRegistry) runTool(name, argsJSON string) (string, error) {
+	t, ok := r.Lookup(name)
+	if !ok {
+		err := fmt.Errorf("model called unknown tool %q", name)
+		return errorOutput(fmt.Sprintf("there is no tool named %q", name)), err
+	}
+	timeout := config.toolTimeouts.of(t)
+	ctx, cancel := opContext("tool "+name, timeout)
+	defer cancel()
+
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- result{err: fmt.Errorf("the tool crashed: %v", p)}
+			}
+		}()
+		out, err := t.Handler(ctx, argsJSON)
+		done <- result{out, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) { //also when the handler gave up on the deadline itself
+		res.err = fmt.Errorf("timeout after %s", timeout)
+	}
+	if res.err != nil {
+		return errorOutput(res.err.Error()), res.err
+	}
+	return res.out, nil
+}
+
+// the function calls of one response run concurrently, on at most this many workers
+const (
+	toolConcurrencyEnvVar  = "REALTIME_CLI_TOOL_CONCURRENCY"
+	defaultToolConcurrency = 4
+)
+
+// parseToolConcurrency reads tool_concurrency of the config file or the environment
+func parseToolConcurrency(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a number >= 1 (1 runs the calls one by one), got %q", name, value)
+	}
+	return n, nil
+}
+
+// defaultTools builds the registry a chat session announces and dispatches to, every session gets its own
+func defaultTools() *ToolRegistry {
+	r := NewToolRegistry()
+	for _, t := range []Tool{multiplyTool, addTool, divideTool, powerTool, sqrtTool, evaluateTool, fetchURLTool} {
+		if err := r.Register(t); err != nil {
+			panic(err) //programming error, the built in tools are fixed
+		}
+	}
+	if config.csvTool {
+		if err := r.Register(queryCSVTool); err != nil {
+			panic(err)
+		}
+	}
+	if config.shellTool {
+		if err := r.Register(runCommandTool(config.shellAllowlist, config.sandbox)); err != nil {
+			panic(err)
+		}
+	}
+	if config.sandbox != "" {
+		for _, t := range []Tool{readFileTool(config.sandbox), writeFileTool(config.sandbox)} {
+			if err := r.Register(t); err != nil {
+				panic(err)
+			}
+		}
+	}
+	if config.kiosk {
+		return r.only(loadKioskTools())
+	}
+	return r
+}
+
+// -------------------------- multiply TOOL --------------------------
+
+var multiplyTool = Tool{
+	Name:        "multiply",
+	Description: "Multiply two numbers and return the result.",
+	JSONSchema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"a": map[string]any{"type": "number"},
+			"b": map[string]any{"type": "number"},
+		},
+		"required": []string{"a", "b"},
+	},
+	Handler: func(_ context.Context, argsJSON string) (string, error) {
+		var args struct {
+			A float64 `json:"a"`
+			B float64 `json:"b"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("bad function args: %w", err)
+		}
+		return fmt.Sprintf(`{"result": %g}`, multiply(args.A, args.B)), nil
+	},
+}
+
+// -------------------------- TOOL FOOTER --------------------------
+
+// -tool-footer (or tool_footer: 1, or the env var set to 1) follows every answer that used tools with a compact footer
+// like [tools: multiply(3,4)→12]
+const toolFooterEnvVar = "REALTIME_CLI_TOOL_FOOTER"
+
+const footerValueMax = 24 //longer argument values and outputs are cut with "…"
+
+// toolUse is one tool call made while answering a turn
+type toolUse struct {
+	Name   string `json:"name"`
+	Args   string `json:"arguments"` //raw JSON arguments from the model
+	Output string `json:"output"`    //JSON output sent back to the model
+}
+
+// toolFooter renders the calls as name(arg,arg)→result
+func toolFooter(used []toolUse) string {
+	parts := make([]string, 0, len(used))
+	for _, u := range used {
+		parts = append(parts, fmt.Sprintf("%s(%s)→%s", u.Name, footerArgs(u.Args), footerOutput(u.Output)))
+	}
+	return "[tools: " + strings.Join(parts, ", ") + "]"
+}
+
+// footerArgs lists the argument values in the order the model wrote them (decoding into a map would shuffle them)
+func footerArgs(argsJSON string) string {
+	dec := json.NewDecoder(strings.NewReader(argsJSON))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return shorten(argsJSON)
+	}
+	var values []string
+	for dec.More() {
+		if _, err := dec.Token(); err != nil { //the key
+			return shorten(argsJSON)
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return shorten(argsJSON)
+		}
+		values = append(values, shorten(string(v)))
+	}
+	return strings.Join(values, ",")
+}
+
+// footerOutput shows just the value for {"result": x} outputs and the shortened JSON otherwise
+func footerOutput(output string) string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(output), &obj); err == nil && len(obj) == 1 {
+		if r, ok := obj["result"]; ok {
+			return shorten(string(r))
+		}
+	}
+	return shorten(output)
+}
+
+func shorten(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > footerValueMax {
+		return string(r[:footerValueMax-1]) + "…"
+	}
+	return s
+}
+
+// -------------------------- TOOL PREVIEW --------------------------
+
+// with -preview-tools (or preview_tools: 1, or the env var set to 1) every tool call is shown before it runs, and the
+// user can run it, edit its arguments or reject it
+const toolPreviewEnvVar = "REALTIME_CLI_PREVIEW_TOOLS"
+
+// what the model gets instead of the tool output when the user rejects a call
+const rejectedToolOutput = `{"error": "the user rejected this tool call"}`
+
+// previewInput is nil when previews are off, otherwise it is the same reader the prompts are read from
+var previewInput *bufio.Reader
+
+func loadToolPreview(in *bufio.Reader) *bufio.Reader {
+	if !config.previewTools {
+		return nil
+	}
+	return in
+}
+
+// previewToolCall returns the arguments to run the tool with and whether the user approved the call
+func previewToolCall(name, argsJSON string) (string, bool) {
+	if previewInput == nil {
+		return argsJSON, true
+	}
+	for {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, []byte(argsJSON), "", "  ") != nil {
+			pretty.Reset()
+			pretty.WriteString(argsJSON)
+		}
+		fmt.Println(colors.tool(fmt.Sprintf("Tool call> %s %s", name, pretty.String())))
+		fmt.Print(colors.tool("Run it? [Enter] run, e edit the arguments, n reject: "))
+		answer, err := previewInput.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+			return argsJSON, false
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "y", "yes":
+			return argsJSON, true
+		case "n", "no":
+			fmt.Println("Rejected, the model will be told so.")
+			return argsJSON, false
+		case "e", "edit":
+			fmt.Print("New arguments (a JSON object on one line)> ")
+			edited, err := previewInput.ReadString('\n')
+			if err != nil {
+				fmt.Println()
+				return argsJSON, false
+			}
+			edited = strings.TrimSpace(edited)
+			var obj map[string]any
+			if err = json.Unmarshal([]byte(edited), &obj); err != nil {
+				fmt.Printf("Not a JSON object (%v), keeping the previous arguments.\n", err)
+				continue
+			}
+			argsJSON = edited
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestToolRegistryInstructions(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools []Tool
+		want  string
+	}{
+		{"no tools", nil, ""},
+		{"multiply", []Tool{multiplyTool}, multipleInstractions},
+		{"one math tool is enough", []Tool{sqrtTool}, mathInstructions},
+		{"the sentence of several tools is used once", []Tool{addTool, divideTool, evaluateTool}, mathInstructions},
+		{"in the order of the sentences", []Tool{fetchURLTool, queryCSVTool, multiplyTool}, multipleInstractions + csvInstructions + fetchInstructions},
+		{"a tool without a sentence", []Tool{readFileTool(t.TempDir())}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewToolRegistry()
+			for _, tool := range tt.tools {
+				if err := r.Register(tool); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := r.Instructions(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	kiosk := defaultTools().only([]string{"multiply"})
+	if got := kiosk.Instructions(); got != multipleInstractions {
+		t.Errorf("kiosk registry got %q, want only the multiply sentence", got)
+	}
+}
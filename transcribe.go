@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+	"nhooyr.io/websocket"
+)
+
+// -------------------------- TRANSCRIBE (subcommand) --------------------------
+
+const (
+	defaultTranscriptionModel = "gpt-4o-mini-transcribe"
+	// how much audio goes into a single input_audio_buffer.append
+	transcribeChunkBytes = audioBytesPerSecond / 5
+)
+
+// transcriptionOptions are the flags shared by every mode that listens to audio (transcribe, notes, ...)
+type transcriptionOptions struct {
+	useMic   bool
+	micCmd   string
+	model    string
+	language string
+	file     string //set from the positional argument when not recording
+
+	vad          string //server_vad or none
+	vadThreshold float64
+	vadPadding   time.Duration
+	vadSilence   time.Duration
+}
+
+func addTranscriptionFlags(fs *flag.FlagSet) *transcriptionOptions {
+	opts := &transcriptionOptions{}
+	fs.BoolVar(&opts.useMic, "mic", false, "record from the microphone (through -mic-cmd) instead of reading a file")
+	fs.StringVar(&opts.micCmd, "mic-cmd", defaultMicCommand, "shell command that writes raw PCM16 mono 24kHz audio to stdout")
+	fs.StringVar(&opts.model, "model", defaultTranscriptionModel, "transcription model")
+	fs.StringVar(&opts.language, "language", "", "ISO-639-1 language of the audio, empty to let the model detect it")
+	fs.StringVar(&opts.vad, "vad", events.TurnDetectionServerVAD, "turn detection: server_vad splits the audio into segments on silence, none sends it as one segment when the audio ends")
+	fs.Float64Var(&opts.vadThreshold, "vad-threshold", 0, "server VAD activation threshold between 0 and 1 (0 keeps the server default)")
+	fs.DurationVar(&opts.vadPadding, "vad-prefix-padding", 0, "audio kept from before the speech started (0 keeps the server default)")
+	fs.DurationVar(&opts.vadSilence, "vad-silence", 0, "silence that ends a segment (0 keeps the server default)")
+	return opts
+}
+
+func (opts *transcriptionOptions) turnDetection() *events.TurnDetection {
+	return &events.TurnDetection{
+		Type:              opts.vad,
+		Threshold:         opts.vadThreshold,
+		PrefixPaddingMs:   int(opts.vadPadding.Milliseconds()),
+		SilenceDurationMs: int(opts.vadSilence.Milliseconds()),
+	}
+}
+
+// parseTranscriptionArgs parses the flags and checks that exactly one audio source (a WAV file or -mic) was given
+func parseTranscriptionArgs(fs *flag.FlagSet, opts *transcriptionOptions, args []string) error {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %[1]s [flags] <file.wav>\n       %[1]s -mic [flags]\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if opts.useMic == (fs.NArg() == 1) || fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("give either one WAV file or -mic")
+	}
+	opts.file = fs.Arg(0)
+	return nil
+}
+
+// runTranscribe streams audio from a WAV file or the microphone through a transcription session and prints the live transcript.
+// no model responses are generated in this mode.
+func runTranscribe(args []string) error {
+	fs := flag.NewFlagSet("transcribe", flag.ExitOnError)
+	opts := addTranscriptionFlags(fs)
+	outPath := fs.String("out", "", "append every finished transcript to this file")
+	if err := parseTranscriptionArgs(fs, opts, args); err != nil {
+		return err
+	}
+
+	var out *os.File
+	if *outPath != "" {
+		var err error
+		out, err = os.OpenFile(*outPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	return runTranscription(opts, func(transcript string) error {
+		if out == nil {
+			return nil
+		}
+		_, err := fmt.Fprintln(out, transcript)
+		return err
+	})
+}
+
+// runTranscription does the actual work of every listening mode: it prints the live transcript and calls onSegment
+// with the final transcript of every audio segment, in order
+func runTranscription(opts *transcriptionOptions, onSegment func(transcript string) error) error {
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return err
+	}
+	apiKey := keys.pick().secret //these modes hold a single connection, so there is nothing to rotate
+	readLimit, err := loadReadLimit()
+	if err != nil {
+		return err
+	}
+
+	// Ctrl+C stops the recording, the transcripts that are still in flight are waited for (a second Ctrl+C quits right away)
+	recordCtx, stopRecording := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopRecording()
+
+	var audio io.Reader
+	if opts.useMic {
+		if !commandAvailable(opts.micCmd) {
+			return fmt.Errorf("the recorder %q was not found, install it or pass -mic-cmd with a command that writes raw PCM16 mono 24kHz to stdout", opts.micCmd)
+		}
+		cmd := shellCommand(recordCtx, opts.micCmd)
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err = cmd.Start(); err != nil {
+			return fmt.Errorf("starting the recorder %q: %w", opts.micCmd, err)
+		}
+		defer cmd.Wait()
+		audio = stdout
+		fmt.Println("Recording, press Ctrl+C to stop.")
+	} else {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if audio, err = openWAV(f); err != nil {
+			return fmt.Errorf("%s: %w", opts.file, err)
+		}
+	}
+
+	dialCtx, cancelDial := opContext("dial", 30*time.Second)
+	conn, err := dialRealtimeURL(dialCtx, apiKey, config.url+"?intent=transcription", protocolBeta, readLimit) //transcription sessions are only used through the beta interface
+	cancelDial()
+	if err != nil {
+		return fmt.Errorf("dial failed: %w", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	sessionCtx, cancelSession := context.WithCancel(context.Background())
+	defer cancelSession()
+	eventsCh, errsCh := startReader(sessionCtx, conn)
+
+	createdCtx, cancelCreated := opContext("wait for transcription session", 10*time.Second)
+	_, err = waitForEventTypeFromChan(createdCtx, eventsCh, "transcription_session.created")
+	cancelCreated()
+	if err != nil {
+		return sessionError(errsCh, err)
+	}
+
+	update, err := events.NewTranscriptionSessionUpdate(events.TranscriptionSession{
+		InputAudioFormat:        "pcm16",
+		InputAudioTranscription: events.Transcription{Model: opts.model, Language: opts.language},
+		TurnDetection:           opts.turnDetection(),
+	})
+	if err != nil {
+		return err
+	}
+	updCtx, cancelUpd := opContext("transcription session update", 10*time.Second)
+	err = marshalAndSend(updCtx, conn, update)
+	cancelUpd()
+	if err != nil {
+		return err
+	}
+
+	senderDone := make(chan error, 1)
+	go func() { senderDone <- streamAudio(recordCtx, conn, audio) }()
+
+	return printTranscripts(conn, eventsCh, errsCh, senderDone, stopRecording, onSegment)
+}
+
+// streamAudio appends the audio to the input buffer chunk by chunk until the source ends or recording is stopped
+func streamAudio(recordCtx context.Context, c *realtimeConn, audio io.Reader) error {
+	buf := make([]byte, transcribeChunkBytes)
+	for {
+		n, err := io.ReadFull(audio, buf)
+		if n > 0 {
+			appendEvt, evtErr := events.NewInputAudioAppend(buf[:n])
+			if evtErr != nil {
+				return evtErr
+			}
+			sendCtx, cancelSend := opContext("append audio", 10*time.Second)
+			sendErr := marshalAndSend(sendCtx, c, appendEvt)
+			cancelSend()
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || recordCtx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading audio: %w", err)
+		}
+	}
+}
+
+// printTranscripts prints transcript deltas as they arrive and returns once the audio ended and every committed segment was transcribed
+func printTranscripts(c *realtimeConn, eventsCh <-chan map[string]any, errsCh <-chan error, senderDone <-chan error, stopRecording func(), onSegment func(string) error) error {
+	pending := map[string]bool{} //committed audio segments (item ids) that have no final transcript yet
+	printed := map[string]bool{}
+	sending, awaitingCommit := true, false
+	var finalTimeout <-chan time.Time
+
+	for sending || awaitingCommit || len(pending) > 0 {
+		select {
+		case err := <-senderDone:
+			sending = false
+			stopRecording()
+			if err != nil {
+				return err
+			}
+			// commit whatever the server VAD didnt commit yet, so the tail of the audio is transcribed too
+			commitCtx, cancelCommit := opContext("commit audio", 10*time.Second)
+			err = marshalAndSend(commitCtx, c, events.NewInputAudioCommit())
+			cancelCommit()
+			if err != nil {
+				return err
+			}
+			awaitingCommit = true
+			finalTimeout = time.After(30 * time.Second)
+
+		case <-finalTimeout:
+			return errors.New("timed out waiting for the last transcripts")
+
+		case err, ok := <-errsCh:
+			if !ok {
+				errsCh = nil //the reader is gone, the closed events channel reports it
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+		case evt, ok := <-eventsCh:
+			if !ok {
+				return sessionError(errsCh, errors.New("connection closed while transcribing"))
+			}
+			itemID, _ := evt["item_id"].(string)
+
+			switch typ, _ := evt["type"].(string); typ {
+			case "error":
+				errObj, _ := evt["error"].(map[string]any)
+				if code, _ := errObj["code"].(string); code == "input_audio_buffer_commit_empty" {
+					awaitingCommit = false //nothing was left to commit
+					continue
+				}
+				return describeServerError(evt)
+
+			case "input_audio_buffer.committed":
+				pending[itemID] = true
+				awaitingCommit = false
+
+			case "conversation.item.input_audio_transcription.delta":
+				delta, _ := evt["delta"].(string)
+				fmt.Print(delta)
+				printed[itemID] = true
+
+			case "conversation.item.input_audio_transcription.completed":
+				transcript, _ := evt["transcript"].(string)
+				if !printed[itemID] {
+					fmt.Print(transcript)
+				}
+				fmt.Println()
+				if err := onSegment(transcript); err != nil {
+					return err
+				}
+				delete(pending, itemID)
+				delete(printed, itemID)
+
+			case "conversation.item.input_audio_transcription.failed":
+				fmt.Fprintf(os.Stderr, "\ntranscription failed for a segment: %v\n", evt["error"])
+				delete(pending, itemID)
+				delete(printed, itemID)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kerenschoss369/go-home-assignment/events"
+)
+
+// -------------------------- TRANSCRIPT (/save) --------------------------
+
+const (
+	savePrefix = "/save"
+	loadPrefix = "/load"
+)
+
+// transcriptEntry is one message of the conversation, assistant entries also carry the tools used for them
+type transcriptEntry struct {
+	Time  time.Time `json:"time"`
+	Role  string    `json:"role"` //user or assistant
+	Text  string    `json:"text"`
+	Tools []toolUse `json:"tools,omitempty"`
+}
+
+// conversationLog keeps every turn of the chat in memory so it can be exported at any point
+type conversationLog struct {
+	Model   string            `json:"model"`
+	Started time.Time         `json:"started"`
+	Entries []transcriptEntry `json:"entries"`
+}
+
+func newConversationLog(model string) *conversationLog {
+	return &conversationLog{Model: model, Started: time.Now(), Entries: []transcriptEntry{}}
+}
+
+// addTurn records a finished turn, asked is when the input was sent
+func (l *conversationLog) addTurn(asked time.Time, input, answer string, used []toolUse) {
+	l.Entries = append(l.Entries,
+		transcriptEntry{Time: asked, Role: "user", Text: input},
+		transcriptEntry{Time: time.Now(), Role: "assistant", Text: answer, Tools: used},
+	)
+}
+
+// save writes the log as JSON or Markdown, picked by the file extension
+func (l *conversationLog) save(path string) error {
+	var data []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var err error
+		if data, err = json.MarshalIndent(l, "", "  "); err != nil {
+			return err
+		}
+	case ".md", ".markdown":
+		data = []byte(l.markdown())
+	default:
+		return fmt.Errorf("unknown transcript format %q, use a .json or .md file", filepath.Ext(path))
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (l *conversationLog) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation (%s, %s)\n", l.Started.Format("2006-01-02 15:04"), l.Model)
+	for _, e := range l.Entries {
+		if e.Role == "user" {
+			fmt.Fprintf(&b, "\n**You** (%s)\n\n%s\n", e.Time.Format("15:04:05"), e.Text)
+			continue
+		}
+		fmt.Fprintf(&b, "\n**Chatbot**\n\n%s\n", e.Text)
+		for _, u := range e.Tools {
+			fmt.Fprintf(&b, "\n- tool `%s`\n  - arguments: `%s`\n  - output: `%s`\n", u.Name, u.Args, u.Output)
+		}
+	}
+	return b.String()
+}
+
+// loadConversationLog reads a transcript written by /save as JSON
+func loadConversationLog(path string) (*conversationLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l conversationLog
+	if err = json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON transcript: %w", path, err)
+	}
+	return &l, nil
+}
+
+// items converts the log into conversation items so it can be sent to a session
+func (l *conversationLog) items() []events.Item {
+	var items []events.Item
+	for _, e := range l.Entries {
+		switch {
+		case e.Text == "":
+			continue
+		case e.Role == "user":
+			items = append(items, events.UserText(e.Text))
+		case e.Role == "assistant":
+			items = append(items, events.AssistantText(e.Text))
+		}
+	}
+	return items
+}
+
+// turns groups the entries into turns (a user entry and what followed it), so merging never separates an answer from its question
+func (l *conversationLog) turns() [][]transcriptEntry {
+	var turns [][]transcriptEntry
+	for _, e := range l.Entries {
+		if e.Role == "user" || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], e)
+	}
+	return turns
+}
+
+// mergeConversationLogs combines two logs, either interleaving their turns by time or appending b after a.
+// two logs forked from the same session start with the same turns, those are kept once
+func mergeConversationLogs(a, b *conversationLog, interleave bool) *conversationLog {
+	merged := &conversationLog{Model: a.Model, Started: a.Started, Entries: []transcriptEntry{}}
+	if b.Started.Before(a.Started) {
+		merged.Started = b.Started
+	}
+
+	aTurns, bTurns := a.turns(), b.turns()
+	turns := append(aTurns, bTurns[sharedTurns(aTurns, bTurns):]...)
+	if interleave {
+		sort.SliceStable(turns, func(i, j int) bool { return turns[i][0].Time.Before(turns[j][0].Time) })
+	}
+	for _, t := range turns {
+		merged.Entries = append(merged.Entries, t...)
+	}
+	return merged
+}
+
+// sharedTurns counts the leading turns both logs have, a turn is shared when its entries have the same time, role and text
+func sharedTurns(a, b [][]transcriptEntry) int {
+	n := 0
+	for n < len(a) && n < len(b) && slices.EqualFunc(a[n], b[n], func(x, y transcriptEntry) bool {
+		return x.Time.Equal(y.Time) && x.Role == y.Role && x.Text == y.Text
+	}) {
+		n++
+	}
+	return n
+}
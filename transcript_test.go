@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeConversationLogs(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 1, 1, 10, min, 0, 0, time.UTC) }
+	turn := func(min int, q, a string) []transcriptEntry {
+		return []transcriptEntry{{Time: at(min), Role: "user", Text: q}, {Time: at(min), Role: "assistant", Text: a}}
+	}
+	log := func(turns ...[]transcriptEntry) *conversationLog {
+		l := &conversationLog{Started: at(0)}
+		for _, t := range turns {
+			l.Entries = append(l.Entries, t...)
+		}
+		return l
+	}
+	texts := func(l *conversationLog) []string {
+		var out []string
+		for _, e := range l.Entries {
+			if e.Role == "user" {
+				out = append(out, e.Text)
+			}
+		}
+		return out
+	}
+
+	shared := [][]transcriptEntry{turn(1, "q1", "a1"), turn(2, "q2", "a2")}
+	forkA := log(shared[0], shared[1], turn(5, "a-only", "x"))
+	forkB := log(shared[0], shared[1], turn(3, "b-only", "y"), turn(7, "b-later", "z"))
+	unrelated := log(turn(1, "q1", "a1 but different"), turn(4, "other", "w"))
+
+	tests := []struct {
+		name       string
+		a, b       *conversationLog
+		interleave bool
+		want       []string
+	}{
+		{"forks interleaved", forkA, forkB, true, []string{"q1", "q2", "b-only", "a-only", "b-later"}},
+		{"forks appended", forkA, forkB, false, []string{"q1", "q2", "a-only", "b-only", "b-later"}},
+		{"same log", forkA, forkA, false, []string{"q1", "q2", "a-only"}},
+		{"different answer is not shared", forkA, unrelated, false, []string{"q1", "q2", "a-only", "q1", "other"}},
+		{"empty", log(), forkB, true, []string{"q1", "q2", "b-only", "b-later"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := texts(mergeConversationLogs(tt.a, tt.b, tt.interleave))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("turns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// -------------------------- TOKEN USAGE + COST --------------------------
+
+const usageCommand = "/usage"
+
+// modelPrice is in USD per million tokens, cached input is billed at its own (lower) rate
+type modelPrice struct {
+	textIn, textCached, textOut    float64
+	audioIn, audioCached, audioOut float64
+}
+
+// modelPrices is matched by prefix (the longest wins) so dated snapshots get the price of their family.
+// these are the published prices at the time of writing and only give an estimate, the invoice is what counts
+var modelPrices = map[string]modelPrice{
+	"gpt-4o-realtime":      {textIn: 5, textCached: 2.5, textOut: 20, audioIn: 40, audioCached: 2.5, audioOut: 80},
+	"gpt-4o-mini-realtime": {textIn: 0.6, textCached: 0.3, textOut: 2.4, audioIn: 10, audioCached: 0.3, audioOut: 20},
+	"gpt-realtime":         {textIn: 4, textCached: 0.4, textOut: 16, audioIn: 32, audioCached: 0.4, audioOut: 64},
+}
+
+func priceOf(model string) (modelPrice, bool) {
+	var best string
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	price, ok := modelPrices[best]
+	return price, ok
+}
+
+// tokenUsage is the usage block of response.done, split the way it is billed
+type tokenUsage struct {
+	textIn, textCached, textOut    int64
+	audioIn, audioCached, audioOut int64
+}
+
+func (u tokenUsage) add(o tokenUsage) tokenUsage {
+	return tokenUsage{u.textIn + o.textIn, u.textCached + o.textCached, u.textOut + o.textOut, u.audioIn + o.audioIn, u.audioCached + o.audioCached, u.audioOut + o.audioOut}
+}
+
+func (u tokenUsage) sub(o tokenUsage) tokenUsage {
+	return tokenUsage{u.textIn - o.textIn, u.textCached - o.textCached, u.textOut - o.textOut, u.audioIn - o.audioIn, u.audioCached - o.audioCached, u.audioOut - o.audioOut}
+}
+
+func (u tokenUsage) input() int64  { return u.textIn + u.textCached + u.audioIn + u.audioCached }
+func (u tokenUsage) output() int64 { return u.textOut + u.audioOut }
+
+func (u tokenUsage) cost(p modelPrice) float64 {
+	return (float64(u.textIn)*p.textIn + float64(u.textCached)*p.textCached + float64(u.textOut)*p.textOut +
+		float64(u.audioIn)*p.audioIn + float64(u.audioCached)*p.audioCached + float64(u.audioOut)*p.audioOut) / 1e6
+}
+
+// usageOf reads response.usage, cached tokens are taken out of the text/audio input counts so nothing is billed twice
+func usageOf(responseDone map[string]any) (tokenUsage, bool) {
+	resp, _ := responseDone["response"].(map[string]any)
+	raw, ok := resp["usage"].(map[string]any)
+	if !ok {
+		return tokenUsage{}, false
+	}
+	in, _ := raw["input_token_details"].(map[string]any)
+	out, _ := raw["output_token_details"].(map[string]any)
+	cached, _ := in["cached_tokens_details"].(map[string]any)
+
+	u := tokenUsage{
+		textIn:      intField(in, "text_tokens"),
+		audioIn:     intField(in, "audio_tokens"),
+		textCached:  intField(cached, "text_tokens"),
+		audioCached: intField(cached, "audio_tokens"),
+		textOut:     intField(out, "text_tokens"),
+		audioOut:    intField(out, "audio_tokens"),
+	}
+	if u.textCached+u.audioCached == 0 { //older payloads only give the total of cached tokens
+		u.textCached = min(intField(in, "cached_tokens"), u.textIn)
+	}
+	u.textIn -= u.textCached
+	u.audioIn -= u.audioCached
+	if in == nil && out == nil { //no breakdown at all, count everything as text
+		u.textIn, u.textOut = intField(raw, "input_tokens"), intField(raw, "output_tokens")
+	}
+	return u, true
+}
+
+func intField(m map[string]any, key string) int64 {
+	n, _ := m[key].(float64)
+	return int64(n)
+}
+
+// usageTracker keeps the cumulative usage of the process, per model so a routed session is priced right
+type usageTracker struct {
+	mu        sync.Mutex
+	model     string //the model the next responses are billed to
+	responses int
+	total     tokenUsage
+	byModel   map[string]tokenUsage
+
+	// routing (-cheap-model): turns the cheap model answered, how many of them were re-asked and what it saved
+	routedTurns, escalations int
+	saved                    float64
+	routingPriced            bool
+}
+
+// usage is nil until main creates it, record and summary are no-ops on nil
+var usage *usageTracker
+
+func newUsageTracker(model string) *usageTracker {
+	return &usageTracker{model: model, byModel: map[string]tokenUsage{}}
+}
+
+// use bills the following responses to this model. turns run one at a time, so the session that starts a response sets its model
+func (t *usageTracker) use(model string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.model = model
+}
+
+// of is the usage of one model so far
+func (t *usageTracker) of(model string) tokenUsage {
+	if t == nil {
+		return tokenUsage{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.byModel[model]
+}
+
+// recordRoutedTurn counts a turn the cheap model answered, what it saved is the same tokens at the strong model's price
+func (t *usageTracker) recordRoutedTurn(turn tokenUsage, cheap, strong string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routedTurns++
+	cheapPrice, ok := priceOf(cheap)
+	strongPrice, ok2 := priceOf(strong)
+	if t.routingPriced = ok && ok2; t.routingPriced {
+		t.saved += turn.cost(strongPrice) - turn.cost(cheapPrice)
+	}
+}
+
+// recordEscalation takes a routed turn back: the strong model answered it after all, so the cheap answer was spent for nothing
+func (t *usageTracker) recordEscalation(turn tokenUsage, strong string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.escalations++
+	if strongPrice, ok := priceOf(strong); ok && t.routingPriced {
+		t.saved -= turn.cost(strongPrice)
+	}
+}
+
+// record adds the usage of a finished (or cancelled, it is billed all the same) response
+func (t *usageTracker) record(responseDone map[string]any) {
+	if t == nil {
+		return
+	}
+	u, ok := usageOf(responseDone)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responses++
+	t.total = t.total.add(u)
+	t.byModel[t.model] = t.byModel[t.model].add(u)
+	slog.Debug("response usage", "input_tokens", u.input(), "output_tokens", u.output())
+}
+
+// summary is what /usage and the end of the session print
+func (t *usageTracker) summary() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Token usage: %d responses, %d input tokens (%d cached), %d output tokens",
+		t.responses, t.total.input(), t.total.textCached+t.total.audioCached, t.total.output())
+	if t.total.audioIn+t.total.audioCached+t.total.audioOut > 0 {
+		fmt.Fprintf(&b, ", of which %d audio in and %d audio out", t.total.audioIn+t.total.audioCached, t.total.audioOut)
+	}
+	var costs []string
+	var cost float64
+	for model, u := range t.byModel {
+		if price, ok := priceOf(model); ok {
+			costs = append(costs, fmt.Sprintf("$%.4f for %s", u.cost(price), model))
+			cost += u.cost(price)
+		}
+	}
+	switch {
+	case len(costs) == 1:
+		fmt.Fprintf(&b, ", about %s", costs[0])
+	case len(costs) > 1:
+		sort.Strings(costs)
+		fmt.Fprintf(&b, ", about $%.4f (%s)", cost, strings.Join(costs, ", "))
+	}
+	b.WriteString(".\n")
+	if t.routedTurns > 0 {
+		fmt.Fprintf(&b, "Routing: %d turns went to the cheap model, %d of them were re-asked with the strong one", t.routedTurns, t.escalations)
+		switch {
+		case !t.routingPriced:
+		case t.saved >= 0:
+			fmt.Fprintf(&b, ", about $%.4f saved compared to the strong model for every turn", t.saved)
+		default:
+			fmt.Fprintf(&b, ", about $%.4f more than the strong model for every turn", -t.saved)
+		}
+		b.WriteString(".\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// -------------------------- ANSWER VALIDATION (-validate) --------------------------
+
+// -validate checks every answer, a failed one is asked again with the problems appended, up to -validate-attempts
+// answers in all. when none passes, the one with the fewest problems is kept
+const (
+	validateCmdTimeout = 30 * time.Second
+	validateOutputMax  = 2 << 10 //of the command output that goes back to the model
+	reaskPrompt        = "Your previous answer failed validation:\n%s\nReply with the full corrected answer only."
+)
+
+// answerValidator returns the problems of an answer, none means it is valid
+type answerValidator func(ctx context.Context, answer string) []string
+
+var validator answerValidator //nil without -validate
+
+// parseValidator parses the value of -validate:
+//
+//	json              the answer must be a JSON value (a ```json fence around it is fine)
+//	json:key1,key2    a JSON object with at least these keys
+//	cmd:program args  the program gets the answer on stdin and must exit with 0, its output explains a failure
+func parseValidator(spec string) (answerValidator, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "json":
+		var keys []string
+		for _, k := range strings.Split(arg, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		return jsonValidator(keys), nil
+	case "cmd":
+		argv, err := splitCommandLine(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(argv) == 0 {
+			return nil, errors.New("cmd: needs a program to run")
+		}
+		return commandValidator(argv), nil
+	default:
+		return nil, fmt.Errorf("unknown validator %q (json, json:key1,key2 or cmd:program args)", spec)
+	}
+}
+
+func jsonValidator(required []string) answerValidator {
+	return func(_ context.Context, answer string) []string {
+		text := stripCodeFence(answer)
+		if len(required) == 0 {
+			if !json.Valid([]byte(text)) {
+				return []string{"the answer is not valid JSON"}
+			}
+			return nil
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(text), &obj); err != nil {
+			return []string{"the answer is not a JSON object: " + err.Error()}
+		}
+		var problems []string
+		for _, k := range required {
+			if _, ok := obj[k]; !ok {
+				problems = append(problems, fmt.Sprintf("the key %q is missing", k))
+			}
+		}
+		return problems
+	}
+}
+
+func commandValidator(argv []string) answerValidator {
+	return func(ctx context.Context, answer string) []string {
+		ctx, cancel := context.WithTimeout(ctx, validateCmdTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stdin = strings.NewReader(answer)
+		var output bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &output, &output
+		err := cmd.Run()
+		if err == nil {
+			return nil
+		}
+		msg := strings.TrimSpace(output.String())
+		if len(msg) > validateOutputMax {
+			msg = msg[:validateOutputMax] + "..."
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return []string{fmt.Sprintf("%s failed: %s", argv[0], msg)}
+	}
+}
+
+// stripCodeFence returns the inside of a markdown code block that is the whole answer
+func stripCodeFence(answer string) string {
+	text := strings.TrimSpace(answer)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+	text = strings.TrimSuffix(text[3:], "```")
+	if _, rest, ok := strings.Cut(text, "\n"); ok { //drop the language tag
+		text = rest
+	}
+	return strings.TrimSpace(text)
+}
+
+// runValidatedTurn runs the turn and asks again while the answer fails -validate
+func runValidatedTurn(cs *chatSession, input, instructions string, out OutputSink, escalate bool) (string, []toolUse, error) {
+	answer, used, err := cs.runTurn(input, instructions, out, escalate)
+	if validator == nil || err != nil {
+		return answer, used, err
+	}
+	problems := validator(context.Background(), answer)
+	best, bestProblems := answer, problems
+	for attempt := 2; len(problems) > 0 && attempt <= config.validateAttempts; attempt++ {
+		fmt.Printf("(the answer failed validation: %s; asking again, attempt %d of %d)\n", problems[0], attempt, config.validateAttempts)
+		var more []toolUse
+		answer, more, err = cs.runTurn(fmt.Sprintf(reaskPrompt, "- "+strings.Join(problems, "\n- ")), instructions, out, false)
+		used = append(used, more...)
+		if err != nil {
+			return best, used, err
+		}
+		problems = validator(context.Background(), answer)
+		if len(problems) <= len(bestProblems) { //a tie goes to the later answer, it has seen more feedback
+			best, bestProblems = answer, problems
+		}
+	}
+	if len(bestProblems) > 0 {
+		fmt.Printf("(no answer passed validation: %s)\n", strings.Join(bestProblems, "; "))
+		if best != answer { //the last answer on screen is not the one kept, it is shown again
+			fmt.Println("(keeping the best attempt:)")
+			out.StartMessage()
+			out.Delta(best)
+			out.EndMessage()
+		}
+	}
+	return best, used, nil
+}